@@ -3,11 +3,11 @@ package cmd
 import (
 	"context"
 	"html"
-	"log"
 	"os"
 	"os/signal"
 	"strconv"
 
+	"github.com/AyushSenapati/guardian/lib/logger"
 	"github.com/AyushSenapati/guardian/lib/server"
 
 	"github.com/AyushSenapati/guardian/config"
@@ -17,6 +17,7 @@ import (
 var (
 	configFile         string
 	svcDefinitionFname string
+	consumersFname     string
 	globalConfig       *config.Specification
 )
 
@@ -33,6 +34,9 @@ func startServerCmd(ctx context.Context) *cobra.Command {
 	cmd.PersistentFlags().StringVarP(
 		&svcDefinitionFname, "svcdef", "d", "definitions.json", "service definition file",
 	)
+	cmd.PersistentFlags().StringVarP(
+		&consumersFname, "consumers", "u", "consumers.json", "consumer file, see consumers.example.json for its format",
+	)
 
 	return cmd
 }
@@ -40,11 +44,16 @@ func startServerCmd(ctx context.Context) *cobra.Command {
 // it starts the gateway server
 func startGuardian(ctx context.Context) error {
 	globalConfig, err := config.Load(configFile)
-	log.Printf("%+v", globalConfig)
 	if err != nil {
-		log.Fatal(err)
+		logger.Fatal("could not load config", "file", configFile, "error", err)
+		return nil
+	}
+
+	if err := logger.Configure(globalConfig.LogLevel, globalConfig.LogFormat); err != nil {
+		logger.Fatal("could not configure logger", "error", err)
 		return nil
 	}
+	logger.Debug("config loaded", "config", globalConfig)
 
 	// Create Guardian server instance with global config
 	srv := server.NewServerWithConfig(globalConfig)
@@ -53,15 +62,15 @@ func startGuardian(ctx context.Context) error {
 	// on interrupt before starting the server
 	ctx = contextWithInterruptSignal(ctx)
 
-	srv.Start(ctx, svcDefinitionFname)
-	log.Println(
-		"Gaurdian >> now sit back, I am up",
-		html.UnescapeString("&#"+strconv.Itoa(128526)+";"),
+	srv.Start(ctx, svcDefinitionFname, consumersFname)
+	logger.Info(
+		"Gaurdian >> now sit back, I am up " +
+			html.UnescapeString("&#"+strconv.Itoa(128526)+";"),
 	)
 
 	srv.Wait(ctx) // waits for stop signal
 
-	log.Println("Guardian >> Bubyee", html.UnescapeString("&#"+strconv.Itoa(9995)+";"))
+	logger.Info("Guardian >> Bubyee " + html.UnescapeString("&#"+strconv.Itoa(9995)+";"))
 	return nil
 }
 
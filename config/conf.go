@@ -1,8 +1,12 @@
 package config
 
 import (
+	"encoding/json"
 	"errors"
+	"fmt"
 
+	"github.com/AyushSenapati/guardian/lib/accesslog"
+	"github.com/AyushSenapati/guardian/lib/realip"
 	"github.com/spf13/viper"
 )
 
@@ -11,11 +15,86 @@ type Specification struct {
 	Port     int
 	AddReqID bool
 
+	// AdminPort is the port admin API listens on. Admin API is disabled if it is 0
+	AdminPort int
+	// AdminAddress is the address admin API listens on. Defaults to 127.0.0.1
+	AdminAddress string
+	// AdminToken is the bearer token the requests to admin API must carry.
+	// It is required to enable admin API
+	AdminToken Secret
+	// Metrics enables collecting metrics, which are exposed on /metrics of admin API
+	Metrics bool
+
 	// in second(s)
 	GraceTimeout int
 	ReadTimeout  int
 	WriteTimeout int
 	IdleTimeout  int
+
+	// LogLevel is one of debug, info, warn and error
+	LogLevel string
+	// LogFormat is either logfmt or json
+	LogFormat string
+
+	// AccessLog configures the access log of all the services,
+	// it can be overridden in the service definition
+	AccessLog accesslog.Config
+
+	// TLS configures the HTTPS listener
+	TLS TLS
+
+	// RealIP configures how the client IP is resolved
+	// for the requests coming through the trusted proxies
+	RealIP realip.Config
+
+	// WatchDefinitions enables reloading service definitions
+	// whenever the definition file changes on disk
+	WatchDefinitions bool
+	// in second(s)
+	WatchInterval int
+}
+
+// Secret is a config value which is not revealed when the config is logged
+type Secret string
+
+func (s Secret) String() string {
+	if s == "" {
+		return ""
+	}
+	return "[redacted]"
+}
+
+// MarshalJSON hides the secret from the JSON logs
+func (s Secret) MarshalJSON() ([]byte, error) {
+	return json.Marshal(s.String())
+}
+
+// TLS defines the HTTPS listener config
+type TLS struct {
+	Enabled bool
+	Port    int
+	// Certificates are served based on the server name (SNI) requested by
+	// the client. First certificate is served if none of them matches
+	Certificates []Certificate
+	// MinVersion is one of 1.0, 1.1, 1.2 and 1.3
+	MinVersion string
+	// CipherSuites are the names of cipher suites as defined in crypto/tls.
+	// Defaults of crypto/tls are used if it is empty. It is ignored by TLS 1.3
+	CipherSuites []string
+	// RedirectHTTP makes the plain HTTP listener redirect all the requests to HTTPS.
+	// Requests are always redirected if client certificates are required
+	RedirectHTTP bool
+	// ClientAuth is one of none, request and require. Client certificates are
+	// verified if presented with request, and are mandatory with require
+	ClientAuth string
+	// ClientCAFile is the PEM bundle client certificates are verified with
+	ClientCAFile string
+}
+
+// Certificate is a certificate and private key pair, both PEM encoded
+type Certificate struct {
+	CertFile string
+	KeyFile  string
 }
 
 func init() {
@@ -25,7 +104,25 @@ func init() {
 	viper.SetDefault("writetimeout", 15)
 	viper.SetDefault("idletimeout", 15)
 
+	viper.SetDefault("adminaddress", "127.0.0.1")
+
 	viper.SetDefault("addreqid", true)
+	viper.SetDefault("metrics", true)
+
+	viper.SetDefault("loglevel", "info")
+	viper.SetDefault("logformat", "logfmt")
+
+	viper.SetDefault("accesslog.enabled", false)
+	viper.SetDefault("accesslog.format", accesslog.FormatCombined)
+	viper.SetDefault("accesslog.output", "stdout")
+
+	viper.SetDefault("tls.enabled", false)
+	viper.SetDefault("tls.port", 8443)
+	viper.SetDefault("tls.minversion", "1.2")
+	viper.SetDefault("tls.clientauth", "none")
+
+	viper.SetDefault("watchdefinitions", true)
+	viper.SetDefault("watchinterval", 2)
 }
 
 // Load reads the config file and returns read configs
@@ -41,5 +138,10 @@ func Load(configFile string) (*Specification, error) {
 		return nil, err
 	}
 
+	// watchers poll the files at this interval, which must be positive
+	if config.WatchInterval <= 0 {
+		return nil, fmt.Errorf("invalid watchinterval `%d`, should be a positive number of seconds", config.WatchInterval)
+	}
+
 	return &config, nil
 }
@@ -0,0 +1,172 @@
+package accesslog
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"text/template"
+	"time"
+
+	"github.com/AyushSenapati/guardian/lib/logger"
+	"github.com/AyushSenapati/guardian/lib/middleware"
+	"github.com/AyushSenapati/guardian/lib/realip"
+	"github.com/AyushSenapati/guardian/lib/router"
+)
+
+// supported formats. Any other format is treated as a text/template
+// which is executed with the Entry
+const (
+	FormatCommon   = "common"
+	FormatCombined = "combined"
+	FormatJSON     = "json"
+)
+
+// Config defines the access log config. It can be set globally
+// and overridden for a service in its definition
+type Config struct {
+	Enabled bool   `json:"enabled"`
+	Format  string `json:"format"`
+	// Output is stdout, stderr or path of the log file
+	Output string `json:"output"`
+	// MaxSize is the size in MB after which the log file is rotated.
+	// Log file is not rotated if it is 0
+	MaxSize int `json:"max_size" mapstructure:"max_size"`
+	// MaxBackups is the number of rotated log files to be retained
+	MaxBackups int `json:"max_backups" mapstructure:"max_backups"`
+}
+
+// Entry is an access log entry
+type Entry struct {
+	Time      time.Time
+	ClientIP  string
+	User      string
+	Method    string
+	URI       string
+	Proto     string
+	Host      string
+	Status    int
+	Bytes     int64
+	Latency   time.Duration
+	Referer   string
+	UserAgent string
+	RequestID string
+	Service   string
+	Route     string
+	Upstream  string
+}
+
+type recordCtxKey struct{}
+
+// record is shared with the handlers down the chain through request context
+type record struct {
+	upstream string
+	// claimed is set if a service specific access log
+	// middleware takes over logging of the request
+	claimed bool
+}
+
+// SetUpstream records the upstream target the request is proxied to
+func SetUpstream(ctx context.Context, upstream string) {
+	if rec, ok := ctx.Value(recordCtxKey{}).(*record); ok {
+		rec.upstream = upstream
+	}
+}
+
+// New returns an access log middleware configured with the given config.
+// When a service specific access log middleware is chained after the global
+// one, the service specific middleware takes over logging of the request
+func New(conf Config) (router.MiddlewareFunc, error) {
+	var write func(*Entry) error
+
+	if conf.Enabled {
+		out, err := openOutput(conf)
+		if err != nil {
+			return nil, err
+		}
+
+		encode, err := newEncoder(conf.Format)
+		if err != nil {
+			return nil, err
+		}
+
+		write = func(e *Entry) error { return encode(out, e) }
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if outer, ok := r.Context().Value(recordCtxKey{}).(*record); ok {
+				outer.claimed = true
+			}
+
+			if write == nil {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			start := time.Now()
+			rec := &record{}
+			rw := middleware.NewResponseWriter(w)
+
+			next.ServeHTTP(rw, r.WithContext(context.WithValue(r.Context(), recordCtxKey{}, rec)))
+
+			if rec.claimed {
+				return
+			}
+
+			entry := newEntry(r, rw, start)
+			entry.Upstream = rec.upstream
+			if err := write(entry); err != nil {
+				logger.FromCtx(r.Context()).Error("could not write access log", "error", err)
+			}
+		})
+	}, nil
+}
+
+func newEntry(r *http.Request, rw *middleware.ResponseWriter, start time.Time) *Entry {
+	route := router.RouteFromCtx(r.Context())
+
+	user := ""
+	if r.URL.User != nil {
+		user = r.URL.User.Username()
+	} else if u, _, ok := r.BasicAuth(); ok {
+		user = u
+	}
+
+	return &Entry{
+		Time:      start,
+		ClientIP:  realip.ClientIP(r),
+		User:      user,
+		Method:    r.Method,
+		URI:       r.RequestURI,
+		Proto:     r.Proto,
+		Host:      r.Host,
+		Status:    rw.Status(),
+		Bytes:     rw.BytesWritten(),
+		Latency:   time.Since(start),
+		Referer:   r.Referer(),
+		UserAgent: r.UserAgent(),
+		RequestID: middleware.ReqIDFromCtx(r.Context()),
+		Service:   route.Service,
+		Route:     route.Path,
+	}
+}
+
+func newEncoder(format string) (func(io.Writer, *Entry) error, error) {
+	switch format {
+	case "", FormatCommon:
+		return encodeCommon, nil
+	case FormatCombined:
+		return encodeCombined, nil
+	case FormatJSON:
+		return encodeJSON, nil
+	}
+
+	tmpl, err := template.New("accesslog").Parse(format)
+	if err != nil {
+		return nil, fmt.Errorf("invalid access log format [%s]", err)
+	}
+	return func(w io.Writer, e *Entry) error {
+		return writeLine(w, func(b io.Writer) error { return tmpl.Execute(b, e) })
+	}, nil
+}
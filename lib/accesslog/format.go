@@ -0,0 +1,117 @@
+package accesslog
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"sync"
+)
+
+const clfTimeLayout = "02/Jan/2006:15:04:05 -0700"
+
+var bufPool = sync.Pool{New: func() interface{} { return new(bytes.Buffer) }}
+
+// writeLine writes whatever fill writes followed by a new line
+// with a single call to the writer, so that entries are not interleaved
+func writeLine(w io.Writer, fill func(io.Writer) error) error {
+	buf := bufPool.Get().(*bytes.Buffer)
+	defer bufPool.Put(buf)
+	buf.Reset()
+
+	if err := fill(buf); err != nil {
+		return err
+	}
+	buf.WriteByte('\n')
+
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+// encodeCommon writes the entry in Common Log Format
+func encodeCommon(w io.Writer, e *Entry) error {
+	return writeLine(w, func(b io.Writer) error {
+		writeCommon(b, e)
+		return nil
+	})
+}
+
+// encodeCombined writes the entry in Combined Log Format
+func encodeCombined(w io.Writer, e *Entry) error {
+	return writeLine(w, func(b io.Writer) error {
+		writeCommon(b, e)
+		fmt.Fprintf(b, " %s %s", strconv.Quote(dashIfEmpty(e.Referer)), strconv.Quote(dashIfEmpty(e.UserAgent)))
+		return nil
+	})
+}
+
+func writeCommon(b io.Writer, e *Entry) {
+	fmt.Fprintf(b, "%s - %s [%s] %s %d %s",
+		dashIfEmpty(e.ClientIP),
+		dashIfEmpty(e.User),
+		e.Time.Format(clfTimeLayout),
+		strconv.Quote(e.Method+" "+e.URI+" "+e.Proto),
+		e.Status,
+		bytesOrDash(e.Bytes),
+	)
+}
+
+func encodeJSON(w io.Writer, e *Entry) error {
+	return writeLine(w, func(b io.Writer) error {
+		raw, err := json.Marshal(struct {
+			Time      string  `json:"time"`
+			ClientIP  string  `json:"client_ip"`
+			User      string  `json:"user,omitempty"`
+			Method    string  `json:"method"`
+			URI       string  `json:"uri"`
+			Proto     string  `json:"proto"`
+			Host      string  `json:"host"`
+			Status    int     `json:"status"`
+			Bytes     int64   `json:"bytes"`
+			Latency   float64 `json:"latency_ms"`
+			Referer   string  `json:"referer,omitempty"`
+			UserAgent string  `json:"user_agent,omitempty"`
+			RequestID string  `json:"request_id,omitempty"`
+			Service   string  `json:"service,omitempty"`
+			Route     string  `json:"route,omitempty"`
+			Upstream  string  `json:"upstream,omitempty"`
+		}{
+			Time:      e.Time.Format("2006-01-02T15:04:05.000Z07:00"),
+			ClientIP:  e.ClientIP,
+			User:      e.User,
+			Method:    e.Method,
+			URI:       e.URI,
+			Proto:     e.Proto,
+			Host:      e.Host,
+			Status:    e.Status,
+			Bytes:     e.Bytes,
+			Latency:   float64(e.Latency.Microseconds()) / 1000,
+			Referer:   e.Referer,
+			UserAgent: e.UserAgent,
+			RequestID: e.RequestID,
+			Service:   e.Service,
+			Route:     e.Route,
+			Upstream:  e.Upstream,
+		})
+		if err != nil {
+			return err
+		}
+		_, err = b.Write(raw)
+		return err
+	})
+}
+
+func dashIfEmpty(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
+
+func bytesOrDash(n int64) string {
+	if n == 0 {
+		return "-"
+	}
+	return strconv.FormatInt(n, 10)
+}
@@ -0,0 +1,112 @@
+package accesslog
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sync"
+)
+
+// outputs keeps the opened log files, so that global and service specific
+// access logs as well as routers created on reload share the same file
+var outputs = struct {
+	sync.Mutex
+	files map[string]*rotatingFile
+}{files: make(map[string]*rotatingFile)}
+
+func openOutput(conf Config) (io.Writer, error) {
+	switch conf.Output {
+	case "", "stdout":
+		return os.Stdout, nil
+	case "stderr":
+		return os.Stderr, nil
+	}
+
+	outputs.Lock()
+	defer outputs.Unlock()
+
+	if f, found := outputs.files[conf.Output]; found {
+		return f, nil
+	}
+
+	f, err := newRotatingFile(conf.Output, int64(conf.MaxSize)*1024*1024, conf.MaxBackups)
+	if err != nil {
+		return nil, err
+	}
+	outputs.files[conf.Output] = f
+	return f, nil
+}
+
+// rotatingFile is a log file which is rotated once it grows beyond max size.
+// Rotated files are suffixed with .1, .2 and so on, .1 being the latest
+type rotatingFile struct {
+	sync.Mutex
+	path       string
+	maxSize    int64
+	maxBackups int
+	file       *os.File
+	size       int64
+}
+
+func newRotatingFile(path string, maxSize int64, maxBackups int) (*rotatingFile, error) {
+	rf := &rotatingFile{path: path, maxSize: maxSize, maxBackups: maxBackups}
+	if err := rf.open(); err != nil {
+		return nil, err
+	}
+	return rf, nil
+}
+
+func (rf *rotatingFile) open() error {
+	f, err := os.OpenFile(rf.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return fmt.Errorf("could not open access log file [%s]", err)
+	}
+
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+
+	rf.file, rf.size = f, info.Size()
+	return nil
+}
+
+func (rf *rotatingFile) Write(p []byte) (int, error) {
+	rf.Lock()
+	defer rf.Unlock()
+
+	if rf.maxSize > 0 && rf.size > 0 && rf.size+int64(len(p)) > rf.maxSize {
+		if err := rf.rotate(); err != nil {
+			return 0, err
+		}
+	}
+
+	n, err := rf.file.Write(p)
+	rf.size += int64(n)
+	return n, err
+}
+
+func (rf *rotatingFile) rotate() error {
+	if err := rf.file.Close(); err != nil {
+		return err
+	}
+
+	if rf.maxBackups <= 0 {
+		os.Remove(rf.path)
+	} else {
+		os.Remove(backupName(rf.path, rf.maxBackups))
+		for i := rf.maxBackups - 1; i >= 1; i-- {
+			os.Rename(backupName(rf.path, i), backupName(rf.path, i+1))
+		}
+		if err := os.Rename(rf.path, backupName(rf.path, 1)); err != nil {
+			return err
+		}
+	}
+
+	return rf.open()
+}
+
+func backupName(path string, n int) string {
+	return fmt.Sprintf("%s.%d", path, n)
+}
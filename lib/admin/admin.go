@@ -0,0 +1,110 @@
+package admin
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/AyushSenapati/guardian/lib/logger"
+	"github.com/AyushSenapati/guardian/lib/metrics"
+	"github.com/AyushSenapati/guardian/lib/middleware"
+	"github.com/AyushSenapati/guardian/lib/proxy"
+	"github.com/AyushSenapati/guardian/lib/service"
+)
+
+// Manager is implemented by the gateway server to let
+// admin API inspect and modify the registered services at runtime
+type Manager interface {
+	// Definitions returns currently registered service definitions
+	Definitions() []*service.Definition
+	// UpdateDefinitions applies the definitions returned by the update func.
+	// Calls to it are serialised so that concurrent updates are not lost
+	UpdateDefinitions(update func([]*service.Definition) ([]*service.Definition, error)) error
+	// Routes returns the registered routes along with their effective middleware chain
+	Routes() []proxy.RouteInfo
+	// Health returns health state of upstream targets of the registered services
+	Health() []proxy.ServiceHealth
+	// PurgeCache removes the cached responses of the service which request
+	// path starts with the prefix. It returns the number of removed entries
+	// and false if the service does not cache the responses
+	PurgeCache(name, prefix string) (int, bool)
+}
+
+// API serves the admin endpoints
+type API struct {
+	manager Manager
+	mux     *http.ServeMux
+	token   string
+}
+
+// NewAPI returns admin API which manages services using the given manager.
+// Requests must carry the token as bearer token in Authorization header
+func NewAPI(manager Manager, token string) *API {
+	api := &API{manager: manager, mux: http.NewServeMux(), token: token}
+
+	api.mux.HandleFunc("/services", api.handleServices)
+	api.mux.HandleFunc("/services/", api.handleService)
+	api.mux.HandleFunc("/routes", api.handleRoutes)
+	api.mux.HandleFunc("/upstreams", api.handleUpstreams)
+	api.mux.Handle("/metrics", metrics.Handler())
+
+	return api
+}
+
+func (api *API) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !api.authorized(r) {
+		w.Header().Set("WWW-Authenticate", `Bearer realm="guardian-admin"`)
+		writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "unauthorized"})
+		return
+	}
+	middleware.EnforceJSON(api.mux).ServeHTTP(w, r)
+}
+
+// authorized reports if the request carries the token.
+// Token is compared in constant time, so that it can not be guessed by timing
+func (api *API) authorized(r *http.Request) bool {
+	const prefix = "Bearer "
+	auth := r.Header.Get("Authorization")
+	if api.token == "" || len(auth) <= len(prefix) || !strings.EqualFold(auth[:len(prefix)], prefix) {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(auth[len(prefix):]), []byte(api.token)) == 1
+}
+
+// GET /routes
+func (api *API) handleRoutes(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		methodNotAllowed(w, http.MethodGet)
+		return
+	}
+	writeJSON(w, http.StatusOK, api.manager.Routes())
+}
+
+// GET /upstreams
+func (api *API) handleUpstreams(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		methodNotAllowed(w, http.MethodGet)
+		return
+	}
+	writeJSON(w, http.StatusOK, api.manager.Health())
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		logger.Error("admin: could not write response", "error", err)
+	}
+}
+
+func writeError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, map[string]string{"error": err.Error()})
+}
+
+func methodNotAllowed(w http.ResponseWriter, allowed ...string) {
+	for _, method := range allowed {
+		w.Header().Add("Allow", method)
+	}
+	writeJSON(w, http.StatusMethodNotAllowed, map[string]string{"error": "method not allowed"})
+}
@@ -0,0 +1,126 @@
+package admin
+
+import (
+	"strings"
+
+	"github.com/AyushSenapati/guardian/lib/service"
+)
+
+// redacted replaces the values of the secret fields of plugin configs in
+// the responses. Definitions sent back with it keep the current values
+const redacted = "[redacted]"
+
+// secretFields are matched against the field names of plugin configs,
+// case insensitively. Fields having any of them in their name are secrets
+var secretFields = []string{"secret", "password", "token", "private_key"}
+
+func isSecretField(name string) bool {
+	name = strings.ToLower(name)
+	for _, f := range secretFields {
+		if strings.Contains(name, f) {
+			return true
+		}
+	}
+	return false
+}
+
+// redact returns a copy of the definition having the secrets of its plugin configs hidden
+func redact(def *service.Definition) *service.Definition {
+	clone := def.Clone()
+	for i, plg := range clone.Plugins {
+		if plg.Config != nil {
+			clone.Plugins[i].Config = redactValue(plg.Config, false).(map[string]interface{})
+		}
+	}
+	return clone
+}
+
+func redactAll(defs []*service.Definition) []*service.Definition {
+	redactedDefs := make([]*service.Definition, 0, len(defs))
+	for _, def := range defs {
+		redactedDefs = append(redactedDefs, redact(def))
+	}
+	return redactedDefs
+}
+
+// redactValue returns a copy of the config value, hiding the values of
+// the secret fields. Values nested in a secret field are hidden as a whole
+func redactValue(v interface{}, secret bool) interface{} {
+	switch value := v.(type) {
+	case map[string]interface{}:
+		if secret {
+			return redacted
+		}
+		m := make(map[string]interface{}, len(value))
+		for k, nested := range value {
+			m[k] = redactValue(nested, isSecretField(k))
+		}
+		return m
+	case []interface{}:
+		if secret {
+			return redacted
+		}
+		s := make([]interface{}, len(value))
+		for i, nested := range value {
+			s[i] = redactValue(nested, false)
+		}
+		return s
+	case nil:
+		return nil
+	}
+	if secret {
+		return redacted
+	}
+	return v
+}
+
+// restoreRedacted replaces the redacted values of the plugin configs of
+// the definition with the values of the current definition, so that
+// definitions read from the admin API can be sent back as they are
+func restoreRedacted(def, current *service.Definition) {
+	seen := map[string]int{}
+	for i, plg := range def.Plugins {
+		// plugins are paired by name and the order they are listed in
+		n := seen[plg.Name]
+		seen[plg.Name]++
+
+		var currentConfig map[string]interface{}
+		for _, c := range current.Plugins {
+			if c.Name != plg.Name {
+				continue
+			}
+			if n == 0 {
+				currentConfig = c.Config
+				break
+			}
+			n--
+		}
+		if plg.Config != nil {
+			def.Plugins[i].Config = restoreValue(plg.Config, currentConfig).(map[string]interface{})
+		}
+	}
+}
+
+func restoreValue(v, current interface{}) interface{} {
+	switch value := v.(type) {
+	case string:
+		if value == redacted && current != nil {
+			return current
+		}
+	case map[string]interface{}:
+		currentMap, _ := current.(map[string]interface{})
+		for k, nested := range value {
+			value[k] = restoreValue(nested, currentMap[k])
+		}
+	case []interface{}:
+		currentSlice, _ := current.([]interface{})
+		for i, nested := range value {
+			var c interface{}
+			if i < len(currentSlice) {
+				c = currentSlice[i]
+			}
+			value[i] = restoreValue(nested, c)
+		}
+	}
+	return v
+}
@@ -0,0 +1,234 @@
+package admin
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/AyushSenapati/guardian/lib/service"
+)
+
+// errNotFound and errConflict are used by the update funcs
+// to let the handlers choose appropriate status code
+var (
+	errNotFound = errors.New("not found")
+	errConflict = errors.New("conflict")
+)
+
+// GET /services, POST /services
+func (api *API) handleServices(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		writeJSON(w, http.StatusOK, redactAll(api.manager.Definitions()))
+
+	case http.MethodPost:
+		def, err := decodeDefinition(r)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+
+		err = api.manager.UpdateDefinitions(
+			func(defs []*service.Definition) ([]*service.Definition, error) {
+				if indexOf(defs, def.Name) >= 0 {
+					return nil, fmt.Errorf("%w: service `%s` already exists", errConflict, def.Name)
+				}
+				return append(defs, def), nil
+			},
+		)
+		if err != nil {
+			writeUpdateError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusCreated, redact(def))
+
+	default:
+		methodNotAllowed(w, http.MethodGet, http.MethodPost)
+	}
+}
+
+// GET, PUT, DELETE /services/{name}
+// POST /services/{name}/plugins/{plugin}/enable|disable
+// DELETE /services/{name}/cache
+func (api *API) handleService(w http.ResponseWriter, r *http.Request) {
+	parts := strings.Split(strings.Trim(strings.TrimPrefix(r.URL.Path, "/services/"), "/"), "/")
+	name := parts[0]
+
+	switch {
+	case len(parts) == 1:
+		api.serveService(w, r, name)
+	case len(parts) == 2 && parts[1] == "cache":
+		api.purgeCache(w, r, name)
+	case len(parts) == 4 && parts[1] == "plugins":
+		if r.Method != http.MethodPost {
+			methodNotAllowed(w, http.MethodPost)
+			return
+		}
+		switch parts[3] {
+		case "enable":
+			api.togglePlugin(w, name, parts[2], true)
+		case "disable":
+			api.togglePlugin(w, name, parts[2], false)
+		default:
+			writeError(w, http.StatusNotFound, errNotFound)
+		}
+	default:
+		writeError(w, http.StatusNotFound, errNotFound)
+	}
+}
+
+func (api *API) serveService(w http.ResponseWriter, r *http.Request, name string) {
+	switch r.Method {
+	case http.MethodGet:
+		defs := api.manager.Definitions()
+		i := indexOf(defs, name)
+		if i < 0 {
+			writeError(w, http.StatusNotFound, fmt.Errorf("service `%s` not found", name))
+			return
+		}
+		writeJSON(w, http.StatusOK, redact(defs[i]))
+
+	case http.MethodPut:
+		def, err := decodeDefinition(r)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		if def.Name != name {
+			writeError(w, http.StatusBadRequest, fmt.Errorf(
+				"service name `%s` does not match the name in the path `%s`", def.Name, name))
+			return
+		}
+
+		err = api.manager.UpdateDefinitions(
+			func(defs []*service.Definition) ([]*service.Definition, error) {
+				i := indexOf(defs, name)
+				if i < 0 {
+					return nil, fmt.Errorf("%w: service `%s`", errNotFound, name)
+				}
+				// secrets read from the API are sent back redacted
+				restoreRedacted(def, defs[i])
+				updated := append([]*service.Definition{}, defs...)
+				updated[i] = def
+				return updated, nil
+			},
+		)
+		if err != nil {
+			writeUpdateError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, redact(def))
+
+	case http.MethodDelete:
+		err := api.manager.UpdateDefinitions(
+			func(defs []*service.Definition) ([]*service.Definition, error) {
+				i := indexOf(defs, name)
+				if i < 0 {
+					return nil, fmt.Errorf("%w: service `%s`", errNotFound, name)
+				}
+				updated := append([]*service.Definition{}, defs[:i]...)
+				return append(updated, defs[i+1:]...), nil
+			},
+		)
+		if err != nil {
+			writeUpdateError(w, err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+
+	default:
+		methodNotAllowed(w, http.MethodGet, http.MethodPut, http.MethodDelete)
+	}
+}
+
+func (api *API) togglePlugin(w http.ResponseWriter, svcName, pluginName string, enable bool) {
+	var def *service.Definition
+
+	err := api.manager.UpdateDefinitions(
+		func(defs []*service.Definition) ([]*service.Definition, error) {
+			i := indexOf(defs, svcName)
+			if i < 0 {
+				return nil, fmt.Errorf("%w: service `%s`", errNotFound, svcName)
+			}
+
+			// definitions in use must not be modified, so work on a copy
+			def = defs[i].Clone()
+			found := false
+			for j := range def.Plugins {
+				if def.Plugins[j].Name == pluginName {
+					def.Plugins[j].Enable = enable
+					found = true
+				}
+			}
+			if !found {
+				return nil, fmt.Errorf(
+					"%w: plugin `%s` is not configured for service `%s`",
+					errNotFound, pluginName, svcName,
+				)
+			}
+
+			updated := append([]*service.Definition{}, defs...)
+			updated[i] = def
+			return updated, nil
+		},
+	)
+	if err != nil {
+		writeUpdateError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, redact(def))
+}
+
+// purgeCache removes the cached responses of the service. Only the
+// responses which request path starts with the path query param are
+// removed, if it is provided
+func (api *API) purgeCache(w http.ResponseWriter, r *http.Request, name string) {
+	if r.Method != http.MethodDelete {
+		methodNotAllowed(w, http.MethodDelete)
+		return
+	}
+
+	purged, found := api.manager.PurgeCache(name, r.URL.Query().Get("path"))
+	if !found {
+		writeError(w, http.StatusNotFound, fmt.Errorf("service `%s` does not have cache enabled", name))
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]int{"purged": purged})
+}
+
+func decodeDefinition(r *http.Request) (*service.Definition, error) {
+	def := service.NewDefinition()
+
+	decoder := json.NewDecoder(r.Body)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(def); err != nil {
+		return nil, fmt.Errorf("malformed service definition [%s]", err)
+	}
+
+	if err := def.Validate(); err != nil {
+		return nil, err
+	}
+	return def, nil
+}
+
+func writeUpdateError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, errNotFound):
+		writeError(w, http.StatusNotFound, err)
+	case errors.Is(err, errConflict):
+		writeError(w, http.StatusConflict, err)
+	default:
+		writeError(w, http.StatusBadRequest, err)
+	}
+}
+
+func indexOf(defs []*service.Definition, name string) int {
+	for i, def := range defs {
+		if def.Name == name {
+			return i
+		}
+	}
+	return -1
+}
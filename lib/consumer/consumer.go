@@ -0,0 +1,132 @@
+package consumer
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sync"
+)
+
+// Consumer is a client of the services proxied by the gateway
+type Consumer struct {
+	Name     string            `json:"name"`
+	Keys     []string          `json:"keys"`
+	Metadata map[string]string `json:"metadata"`
+}
+
+// Registry holds the consumers and lets them be looked up by their keys
+type Registry struct {
+	sync.RWMutex
+	consumers []*Consumer
+	// keys are stored hashed, so that the lookup
+	// time does not depend on how much of a key matches
+	byKey map[[sha256.Size]byte]*Consumer
+}
+
+// registry is the consumer registry of the gateway
+var registry = NewRegistry()
+
+// NewRegistry returns an empty consumer registry
+func NewRegistry() *Registry {
+	return &Registry{byKey: make(map[[sha256.Size]byte]*Consumer)}
+}
+
+// Set replaces the consumers of the registry.
+// It fails if names or keys of the consumers are not unique
+func (r *Registry) Set(consumers []*Consumer) error {
+	names := make(map[string]bool)
+	byKey := make(map[[sha256.Size]byte]*Consumer)
+
+	for _, c := range consumers {
+		if c.Name == "" {
+			return errors.New("consumer name can not be blank")
+		}
+		if names[c.Name] {
+			return fmt.Errorf("consumer `%s` is defined more than once", c.Name)
+		}
+		names[c.Name] = true
+
+		for _, key := range c.Keys {
+			if key == "" {
+				return fmt.Errorf("consumer `%s` has a blank key", c.Name)
+			}
+			hash := sha256.Sum256([]byte(key))
+			if other, found := byKey[hash]; found {
+				return fmt.Errorf("consumers `%s` and `%s` share a key", other.Name, c.Name)
+			}
+			byKey[hash] = c
+		}
+	}
+
+	r.Lock()
+	defer r.Unlock()
+	r.consumers, r.byKey = consumers, byKey
+	return nil
+}
+
+// Lookup returns the consumer the given key belongs to
+func (r *Registry) Lookup(key string) (*Consumer, bool) {
+	r.RLock()
+	defer r.RUnlock()
+
+	c, found := r.byKey[sha256.Sum256([]byte(key))]
+	return c, found
+}
+
+// Get returns the consumer with the given name
+func (r *Registry) Get(name string) (*Consumer, bool) {
+	r.RLock()
+	defer r.RUnlock()
+
+	for _, c := range r.consumers {
+		if c.Name == name {
+			return c, true
+		}
+	}
+	return nil, false
+}
+
+// Load reads the consumer file and replaces the consumers of the gateway.
+// A missing file is treated as no consumers
+func Load(filePath string) error {
+	raw, err := ioutil.ReadFile(filePath)
+	if os.IsNotExist(err) {
+		return registry.Set(nil)
+	}
+	if err != nil {
+		return fmt.Errorf("error reading consumer file %s: %w", filePath, err)
+	}
+
+	var consumers []*Consumer
+	if err := json.Unmarshal(raw, &consumers); err != nil {
+		return fmt.Errorf("error parsing consumer file %s: %w", filePath, err)
+	}
+	return registry.Set(consumers)
+}
+
+// Lookup returns the consumer of the gateway the given key belongs to
+func Lookup(key string) (*Consumer, bool) {
+	return registry.Lookup(key)
+}
+
+// Get returns the consumer of the gateway with the given name
+func Get(name string) (*Consumer, bool) {
+	return registry.Get(name)
+}
+
+type consumerCtxKey struct{}
+
+// WithConsumer adds the authenticated consumer to the given context
+func WithConsumer(ctx context.Context, c *Consumer) context.Context {
+	return context.WithValue(ctx, consumerCtxKey{}, c)
+}
+
+// FromCtx returns the authenticated consumer of the request
+func FromCtx(ctx context.Context) (*Consumer, bool) {
+	c, ok := ctx.Value(consumerCtxKey{}).(*Consumer)
+	return c, ok
+}
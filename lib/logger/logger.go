@@ -0,0 +1,267 @@
+package logger
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/AyushSenapati/guardian/lib/middleware"
+	"github.com/AyushSenapati/guardian/lib/router"
+)
+
+// Level defines the severity of a log entry
+type Level int
+
+// supported log levels
+const (
+	DebugLevel Level = iota
+	InfoLevel
+	WarnLevel
+	ErrorLevel
+	FatalLevel
+)
+
+// supported output formats
+const (
+	FormatLogfmt = "logfmt"
+	FormatJSON   = "json"
+)
+
+var levelNames = map[Level]string{
+	DebugLevel: "debug",
+	InfoLevel:  "info",
+	WarnLevel:  "warn",
+	ErrorLevel: "error",
+	FatalLevel: "fatal",
+}
+
+func (l Level) String() string {
+	return levelNames[l]
+}
+
+// ParseLevel returns the level for the given name
+func ParseLevel(name string) (Level, error) {
+	switch strings.ToLower(name) {
+	case "debug":
+		return DebugLevel, nil
+	case "", "info":
+		return InfoLevel, nil
+	case "warn", "warning":
+		return WarnLevel, nil
+	case "error":
+		return ErrorLevel, nil
+	}
+	return InfoLevel, fmt.Errorf("unsupported log level `%s`, should be of (debug/info/warn/error)", name)
+}
+
+// output is shared by all the loggers
+var output = struct {
+	sync.Mutex
+	w      io.Writer
+	level  Level
+	format string
+}{w: os.Stderr, level: InfoLevel, format: FormatLogfmt}
+
+// Configure sets the level and format of the log entries written by all loggers
+func Configure(level, format string) error {
+	lvl, err := ParseLevel(level)
+	if err != nil {
+		return err
+	}
+
+	switch format {
+	case "":
+		format = FormatLogfmt
+	case FormatLogfmt, FormatJSON:
+	default:
+		return fmt.Errorf("unsupported log format `%s`, should be of (logfmt/json)", format)
+	}
+
+	output.Lock()
+	defer output.Unlock()
+	output.level, output.format = lvl, format
+	return nil
+}
+
+// SetOutput sets the writer log entries are written to
+func SetOutput(w io.Writer) {
+	output.Lock()
+	defer output.Unlock()
+	output.w = w
+}
+
+// Logger writes leveled log entries along with its fields
+type Logger struct {
+	fields []interface{}
+}
+
+var std = &Logger{}
+
+// With returns a logger which adds the given key value pairs to every entry
+func With(keyvals ...interface{}) *Logger {
+	return std.With(keyvals...)
+}
+
+// FromCtx returns a logger which adds request ID, service name
+// and route of the request found in the given context to every entry
+func FromCtx(ctx context.Context) *Logger {
+	var fields []interface{}
+	if reqID := middleware.ReqIDFromCtx(ctx); reqID != "" {
+		fields = append(fields, "request_id", reqID)
+	}
+	if route := router.RouteFromCtx(ctx); route.Service != "" {
+		fields = append(fields, "service", route.Service, "route", route.Path)
+	}
+	return &Logger{fields: fields}
+}
+
+// With returns a logger which adds the given key value pairs
+// along with the fields of the logger to every entry
+func (l *Logger) With(keyvals ...interface{}) *Logger {
+	fields := make([]interface{}, 0, len(l.fields)+len(keyvals))
+	fields = append(append(fields, l.fields...), keyvals...)
+	return &Logger{fields: fields}
+}
+
+// Debug logs at debug level
+func (l *Logger) Debug(msg string, keyvals ...interface{}) { l.log(DebugLevel, msg, keyvals) }
+
+// Info logs at info level
+func (l *Logger) Info(msg string, keyvals ...interface{}) { l.log(InfoLevel, msg, keyvals) }
+
+// Warn logs at warn level
+func (l *Logger) Warn(msg string, keyvals ...interface{}) { l.log(WarnLevel, msg, keyvals) }
+
+// Error logs at error level
+func (l *Logger) Error(msg string, keyvals ...interface{}) { l.log(ErrorLevel, msg, keyvals) }
+
+// Fatal logs at fatal level and exits the process
+func (l *Logger) Fatal(msg string, keyvals ...interface{}) {
+	l.log(FatalLevel, msg, keyvals)
+	os.Exit(1)
+}
+
+// Debug logs at debug level
+func Debug(msg string, keyvals ...interface{}) { std.log(DebugLevel, msg, keyvals) }
+
+// Info logs at info level
+func Info(msg string, keyvals ...interface{}) { std.log(InfoLevel, msg, keyvals) }
+
+// Warn logs at warn level
+func Warn(msg string, keyvals ...interface{}) { std.log(WarnLevel, msg, keyvals) }
+
+// Error logs at error level
+func Error(msg string, keyvals ...interface{}) { std.log(ErrorLevel, msg, keyvals) }
+
+// Fatal logs at fatal level and exits the process
+func Fatal(msg string, keyvals ...interface{}) {
+	std.log(FatalLevel, msg, keyvals)
+	os.Exit(1)
+}
+
+func (l *Logger) log(level Level, msg string, keyvals []interface{}) {
+	output.Lock()
+	defer output.Unlock()
+
+	if level < output.level {
+		return
+	}
+
+	kvs := append(
+		[]interface{}{"time", time.Now().Format(time.RFC3339Nano), "level", level, "msg", msg},
+		l.fields...,
+	)
+	kvs = append(kvs, keyvals...)
+	if len(kvs)%2 != 0 {
+		kvs = append(kvs, "(MISSING)")
+	}
+
+	var b strings.Builder
+	if output.format == FormatJSON {
+		encodeJSON(&b, kvs)
+	} else {
+		encodeLogfmt(&b, kvs)
+	}
+	b.WriteByte('\n')
+
+	io.WriteString(output.w, b.String())
+}
+
+func encodeJSON(b *strings.Builder, kvs []interface{}) {
+	b.WriteByte('{')
+	for i := 0; i < len(kvs); i += 2 {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		key, _ := json.Marshal(fmt.Sprint(kvs[i]))
+		b.Write(key)
+		b.WriteByte(':')
+
+		value, err := json.Marshal(jsonValue(kvs[i+1]))
+		if err != nil {
+			value, _ = json.Marshal(fmt.Sprintf("%+v", kvs[i+1]))
+		}
+		b.Write(value)
+	}
+	b.WriteByte('}')
+}
+
+func jsonValue(v interface{}) interface{} {
+	switch value := v.(type) {
+	case error:
+		return value.Error()
+	case fmt.Stringer:
+		return value.String()
+	}
+	return v
+}
+
+func encodeLogfmt(b *strings.Builder, kvs []interface{}) {
+	for i := 0; i < len(kvs); i += 2 {
+		if i > 0 {
+			b.WriteByte(' ')
+		}
+		b.WriteString(fmt.Sprint(kvs[i]))
+		b.WriteByte('=')
+
+		var value string
+		switch v := kvs[i+1].(type) {
+		case error:
+			value = v.Error()
+		case fmt.Stringer:
+			value = v.String()
+		case string:
+			value = v
+		default:
+			value = fmt.Sprintf("%+v", v)
+		}
+
+		if value == "" || strings.ContainsAny(value, " =\"\t\r\n\\") {
+			value = strconv.Quote(value)
+		}
+		b.WriteString(value)
+	}
+}
+
+// stdWriter adapts the logger to io.Writer
+type stdWriter struct {
+	level Level
+}
+
+func (w stdWriter) Write(p []byte) (int, error) {
+	std.log(w.level, strings.TrimSuffix(string(p), "\n"), nil)
+	return len(p), nil
+}
+
+// StdLogger returns a standard library logger which writes entries at the
+// given level. It is useful for packages like net/http that take *log.Logger
+func StdLogger(level Level) *log.Logger {
+	return log.New(stdWriter{level}, "", 0)
+}
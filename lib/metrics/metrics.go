@@ -0,0 +1,103 @@
+package metrics
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/AyushSenapati/guardian/lib/logger"
+	"github.com/AyushSenapati/guardian/lib/middleware"
+	"github.com/AyushSenapati/guardian/lib/router"
+)
+
+// metrics exposed by the gateway
+var (
+	RequestsTotal = NewCounterVec(
+		"guardian_http_requests_total",
+		"Total number of HTTP requests served.",
+		"service", "route", "method", "code",
+	)
+	RequestDuration = NewHistogramVec(
+		"guardian_http_request_duration_seconds",
+		"Latency of HTTP requests in seconds.",
+		DefaultBuckets, "service", "route", "method",
+	)
+	RequestsInFlight = NewGaugeVec(
+		"guardian_upstream_requests_in_flight",
+		"Number of requests being proxied to upstream.",
+		"service",
+	)
+	UpstreamErrors = NewCounterVec(
+		"guardian_upstream_errors_total",
+		"Total number of requests failed to reach upstream.",
+		"service", "target",
+	)
+	UpstreamRetries = NewCounterVec(
+		"guardian_upstream_retries_total",
+		"Total number of retried upstream requests.",
+		"service",
+	)
+	LimiterRejections = NewCounterVec(
+		"guardian_limiter_rejections_total",
+		"Total number of requests rejected by rate limiter.",
+		"service",
+	)
+	CircuitBreakerState = NewGaugeVec(
+		"guardian_circuit_breaker_state",
+		"State of the circuit breaker (0: closed, 1: open, 2: half-open).",
+		"service",
+	)
+	CircuitBreakerTransitions = NewCounterVec(
+		"guardian_circuit_breaker_transitions_total",
+		"Total number of circuit breaker state transitions.",
+		"service", "state",
+	)
+	CircuitBreakerRejections = NewCounterVec(
+		"guardian_circuit_breaker_rejections_total",
+		"Total number of requests short-circuited by circuit breaker.",
+		"service",
+	)
+	CacheRequests = NewCounterVec(
+		"guardian_cache_requests_total",
+		"Total number of requests served by cache, by cache status.",
+		"service", "status",
+	)
+)
+
+// Middleware records request count and latency of every routed request
+func Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		rw := middleware.NewResponseWriter(w)
+
+		next.ServeHTTP(rw, r)
+
+		route := router.RouteFromCtx(r.Context())
+		method := methodLabel(r.Method)
+		RequestsTotal.With(route.Service, route.Path, method, strconv.Itoa(rw.Status())).Inc()
+		RequestDuration.With(route.Service, route.Path, method).Observe(
+			time.Since(start).Seconds())
+	})
+}
+
+// methodLabel returns the method as the label value. Methods other than the
+// standard ones are labeled as other, so that the clients can not create
+// new series by sending arbitrary methods
+func methodLabel(method string) string {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut, http.MethodPatch,
+		http.MethodDelete, http.MethodConnect, http.MethodOptions, http.MethodTrace:
+		return method
+	}
+	return "other"
+}
+
+// Handler serves the metrics in prometheus text exposition format
+func Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		if _, err := registry.WriteTo(w); err != nil {
+			logger.FromCtx(r.Context()).Error("metrics: could not write metrics", "error", err)
+		}
+	})
+}
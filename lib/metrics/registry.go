@@ -0,0 +1,330 @@
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// DefaultBuckets are the latency buckets (in seconds) used by histograms
+var DefaultBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+// registry holds all the metric families exposed by the gateway
+var registry = &Registry{}
+
+// collector is implemented by every metric family
+type collector interface {
+	write(w io.Writer)
+}
+
+// Registry is the collection of metric families
+type Registry struct {
+	sync.RWMutex
+	collectors []collector
+}
+
+func (r *Registry) register(c collector) {
+	r.Lock()
+	defer r.Unlock()
+	r.collectors = append(r.collectors, c)
+}
+
+// WriteTo writes all the metrics in prometheus text exposition format
+func (r *Registry) WriteTo(w io.Writer) (int64, error) {
+	r.RLock()
+	defer r.RUnlock()
+
+	cw := &countingWriter{w: bufio.NewWriter(w)}
+	for _, c := range r.collectors {
+		c.write(cw)
+	}
+	return cw.n, cw.w.Flush()
+}
+
+type countingWriter struct {
+	w *bufio.Writer
+	n int64
+}
+
+func (cw *countingWriter) Write(b []byte) (int, error) {
+	n, err := cw.w.Write(b)
+	cw.n += int64(n)
+	return n, err
+}
+
+// family holds the series of a metric, one per unique combination of label values
+type family struct {
+	sync.RWMutex
+	name   string
+	help   string
+	typ    string
+	labels []string
+	series map[string]*series
+}
+
+type series struct {
+	sync.Mutex
+	labelValues []string
+	value       float64
+	buckets     []uint64 // cumulative counts are computed while writing
+	count       uint64
+}
+
+func newFamily(name, help, typ string, labels []string) *family {
+	return &family{
+		name:   name,
+		help:   help,
+		typ:    typ,
+		labels: labels,
+		series: make(map[string]*series),
+	}
+}
+
+func (f *family) with(labelValues []string, buckets int) *series {
+	if len(labelValues) != len(f.labels) {
+		panic(fmt.Sprintf(
+			"metrics: %s expects %d label values, got %d", f.name, len(f.labels), len(labelValues)))
+	}
+	key := strings.Join(labelValues, "\xff")
+
+	f.RLock()
+	s, found := f.series[key]
+	f.RUnlock()
+	if found {
+		return s
+	}
+
+	f.Lock()
+	defer f.Unlock()
+	if s, found = f.series[key]; !found {
+		s = &series{
+			labelValues: append([]string{}, labelValues...),
+			buckets:     make([]uint64, buckets),
+		}
+		f.series[key] = s
+	}
+	return s
+}
+
+func (f *family) sortedSeries() []*series {
+	f.RLock()
+	defer f.RUnlock()
+
+	keys := make([]string, 0, len(f.series))
+	for k := range f.series {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	all := make([]*series, 0, len(keys))
+	for _, k := range keys {
+		all = append(all, f.series[k])
+	}
+	return all
+}
+
+func (f *family) writeHeader(w io.Writer) {
+	fmt.Fprintf(w, "# HELP %s %s\n", f.name, escapeHelp(f.help))
+	fmt.Fprintf(w, "# TYPE %s %s\n", f.name, f.typ)
+}
+
+func (f *family) write(w io.Writer) {
+	f.writeHeader(w)
+	for _, s := range f.sortedSeries() {
+		s.Lock()
+		value := s.value
+		s.Unlock()
+		fmt.Fprintf(w, "%s%s %s\n", f.name, formatLabels(f.labels, s.labelValues), formatValue(value))
+	}
+}
+
+// CounterVec is a counter partitioned by labels
+type CounterVec struct {
+	*family
+}
+
+// Counter is a single series of a CounterVec
+type Counter struct {
+	s *series
+}
+
+// NewCounterVec creates and registers a counter metric
+func NewCounterVec(name, help string, labels ...string) *CounterVec {
+	c := &CounterVec{newFamily(name, help, "counter", labels)}
+	registry.register(c)
+	return c
+}
+
+// With returns the counter for the given label values
+func (c *CounterVec) With(labelValues ...string) Counter {
+	return Counter{c.with(labelValues, 0)}
+}
+
+// Inc increments the counter by 1
+func (c Counter) Inc() {
+	c.Add(1)
+}
+
+// Add adds the given non-negative value to the counter
+func (c Counter) Add(v float64) {
+	if v < 0 {
+		return
+	}
+	c.s.Lock()
+	c.s.value += v
+	c.s.Unlock()
+}
+
+// GaugeVec is a gauge partitioned by labels
+type GaugeVec struct {
+	*family
+}
+
+// Gauge is a single series of a GaugeVec
+type Gauge struct {
+	s *series
+}
+
+// NewGaugeVec creates and registers a gauge metric
+func NewGaugeVec(name, help string, labels ...string) *GaugeVec {
+	g := &GaugeVec{newFamily(name, help, "gauge", labels)}
+	registry.register(g)
+	return g
+}
+
+// With returns the gauge for the given label values
+func (g *GaugeVec) With(labelValues ...string) Gauge {
+	return Gauge{g.with(labelValues, 0)}
+}
+
+// Set sets the gauge to the given value
+func (g Gauge) Set(v float64) {
+	g.s.Lock()
+	g.s.value = v
+	g.s.Unlock()
+}
+
+// Add adds the given value to the gauge
+func (g Gauge) Add(v float64) {
+	g.s.Lock()
+	g.s.value += v
+	g.s.Unlock()
+}
+
+// Inc increments the gauge by 1
+func (g Gauge) Inc() { g.Add(1) }
+
+// Dec decrements the gauge by 1
+func (g Gauge) Dec() { g.Add(-1) }
+
+// HistogramVec is a histogram partitioned by labels
+type HistogramVec struct {
+	*family
+	upperBounds []float64
+}
+
+// Histogram is a single series of a HistogramVec
+type Histogram struct {
+	s           *series
+	upperBounds []float64
+}
+
+// NewHistogramVec creates and registers a histogram metric with the given buckets
+func NewHistogramVec(name, help string, buckets []float64, labels ...string) *HistogramVec {
+	upperBounds := append([]float64{}, buckets...)
+	sort.Float64s(upperBounds)
+	h := &HistogramVec{newFamily(name, help, "histogram", labels), upperBounds}
+	registry.register(h)
+	return h
+}
+
+// With returns the histogram for the given label values
+func (h *HistogramVec) With(labelValues ...string) Histogram {
+	return Histogram{h.with(labelValues, len(h.upperBounds)), h.upperBounds}
+}
+
+// Observe adds the given value to the histogram
+func (h Histogram) Observe(v float64) {
+	i := sort.SearchFloat64s(h.upperBounds, v)
+
+	h.s.Lock()
+	if i < len(h.s.buckets) {
+		h.s.buckets[i]++
+	}
+	h.s.count++
+	h.s.value += v
+	h.s.Unlock()
+}
+
+func (h *HistogramVec) write(w io.Writer) {
+	h.writeHeader(w)
+
+	labels := append(append([]string{}, h.labels...), "le")
+	for _, s := range h.sortedSeries() {
+		s.Lock()
+		buckets := append([]uint64{}, s.buckets...)
+		count, sum := s.count, s.value
+		s.Unlock()
+
+		var cumulative uint64
+		for i, upperBound := range h.upperBounds {
+			cumulative += buckets[i]
+			values := append(append([]string{}, s.labelValues...), formatValue(upperBound))
+			fmt.Fprintf(w, "%s_bucket%s %d\n", h.name, formatLabels(labels, values), cumulative)
+		}
+		values := append(append([]string{}, s.labelValues...), "+Inf")
+		fmt.Fprintf(w, "%s_bucket%s %d\n", h.name, formatLabels(labels, values), count)
+		fmt.Fprintf(w, "%s_sum%s %s\n", h.name, formatLabels(h.labels, s.labelValues), formatValue(sum))
+		fmt.Fprintf(w, "%s_count%s %d\n", h.name, formatLabels(h.labels, s.labelValues), count)
+	}
+}
+
+func formatLabels(names, values []string) string {
+	if len(names) == 0 {
+		return ""
+	}
+
+	var b strings.Builder
+	b.WriteByte('{')
+	for i, name := range names {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		b.WriteString(name)
+		b.WriteString(`="`)
+		b.WriteString(escapeLabelValue(values[i]))
+		b.WriteByte('"')
+	}
+	b.WriteByte('}')
+	return b.String()
+}
+
+func formatValue(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+var (
+	labelValueEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+	helpEscaper       = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+)
+
+func escapeLabelValue(v string) string {
+	return labelValueEscaper.Replace(v)
+}
+
+func escapeHelp(help string) string {
+	return helpEscaper.Replace(help)
+}
@@ -0,0 +1,18 @@
+package middleware
+
+import "context"
+
+type claimsCtxKey struct{}
+
+// WithClaims adds the claims of the verified token of the request to the
+// given context. Authentication plugins use it, so that the other plugins
+// can read the claims without depending on them
+func WithClaims(ctx context.Context, claims map[string]interface{}) context.Context {
+	return context.WithValue(ctx, claimsCtxKey{}, claims)
+}
+
+// ClaimsFromCtx retrieves the claims of the verified token from the given context
+func ClaimsFromCtx(ctx context.Context) (map[string]interface{}, bool) {
+	claims, ok := ctx.Value(claimsCtxKey{}).(map[string]interface{})
+	return claims, ok
+}
@@ -0,0 +1,29 @@
+package middleware
+
+import (
+	"context"
+	"crypto/x509"
+	"net/http"
+)
+
+type clientCertCtxKey struct{}
+
+// ClientCertFromCtx retrieves the verified client certificate from the given context
+func ClientCertFromCtx(ctx context.Context) (*x509.Certificate, bool) {
+	cert, ok := ctx.Value(clientCertCtxKey{}).(*x509.Certificate)
+	return cert, ok
+}
+
+// ClientCertificate middleware adds the verified client certificate of the
+// TLS connection to the request context, so that plugins can identify the
+// client by the certificate subject. Unverified certificates are ignored
+func ClientCertificate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.TLS != nil && len(r.TLS.VerifiedChains) > 0 && len(r.TLS.VerifiedChains[0]) > 0 {
+			cert := r.TLS.VerifiedChains[0][0]
+			r = r.WithContext(context.WithValue(r.Context(), clientCertCtxKey{}, cert))
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
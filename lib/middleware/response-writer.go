@@ -0,0 +1,133 @@
+package middleware
+
+import (
+	"bufio"
+	"errors"
+	"net"
+	"net/http"
+)
+
+// ResponseWriter wraps http.ResponseWriter to record the status code
+// and number of bytes written, so that middlewares can inspect the response
+// after the request is served. It keeps flushing and hijacking working
+type ResponseWriter struct {
+	http.ResponseWriter
+	status int
+	bytes  int64
+}
+
+// NewResponseWriter wraps the given http.ResponseWriter
+func NewResponseWriter(w http.ResponseWriter) *ResponseWriter {
+	return &ResponseWriter{ResponseWriter: w}
+}
+
+// WriteHeader records the status code and writes it
+func (w *ResponseWriter) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *ResponseWriter) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	n, err := w.ResponseWriter.Write(b)
+	w.bytes += int64(n)
+	return n, err
+}
+
+// Flush sends any buffered data to the client
+func (w *ResponseWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Hijack lets the caller take over the connection
+func (w *ResponseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	h, ok := w.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New("underlying response writer does not support hijacking")
+	}
+	if w.status == 0 {
+		w.status = http.StatusSwitchingProtocols
+	}
+	return h.Hijack()
+}
+
+// Status returns the status code written. It is 200
+// if nothing is written as net/http responds with 200 then
+func (w *ResponseWriter) Status() int {
+	if w.status == 0 {
+		return http.StatusOK
+	}
+	return w.status
+}
+
+// Written reports if the status code has been written
+func (w *ResponseWriter) Written() bool {
+	return w.status != 0
+}
+
+// BytesWritten returns the number of bytes of body written
+func (w *ResponseWriter) BytesWritten() int64 {
+	return w.bytes
+}
+
+// HeaderWriter wraps http.ResponseWriter to call the hook right before the
+// headers are written, so that middlewares can change the headers set by
+// the handlers after them. It keeps flushing and hijacking working
+type HeaderWriter struct {
+	http.ResponseWriter
+	hook   func(h http.Header, status int)
+	called bool
+}
+
+// NewHeaderWriter wraps the given http.ResponseWriter. The hook is called
+// once, with the headers and the status code about to be written
+func NewHeaderWriter(w http.ResponseWriter, hook func(h http.Header, status int)) *HeaderWriter {
+	return &HeaderWriter{ResponseWriter: w, hook: hook}
+}
+
+func (w *HeaderWriter) callHook(status int) {
+	if !w.called {
+		w.called = true
+		w.hook(w.ResponseWriter.Header(), status)
+	}
+}
+
+// WriteHeader calls the hook and writes the status code
+func (w *HeaderWriter) WriteHeader(status int) {
+	w.callHook(status)
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *HeaderWriter) Write(b []byte) (int, error) {
+	w.callHook(http.StatusOK)
+	return w.ResponseWriter.Write(b)
+}
+
+// Flush sends any buffered data to the client
+func (w *HeaderWriter) Flush() {
+	w.callHook(http.StatusOK)
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Hijack lets the caller take over the connection
+func (w *HeaderWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	h, ok := w.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New("underlying response writer does not support hijacking")
+	}
+	return h.Hijack()
+}
+
+// Done calls the hook if nothing has been written. It must be called once
+// the handler returns, as net/http writes the headers then
+func (w *HeaderWriter) Done() {
+	w.callHook(http.StatusOK)
+}
@@ -0,0 +1,412 @@
+package cache
+
+import (
+	"bufio"
+	"bytes"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/AyushSenapati/guardian/lib/consumer"
+	"github.com/AyushSenapati/guardian/lib/logger"
+	"github.com/AyushSenapati/guardian/lib/metrics"
+	"github.com/AyushSenapati/guardian/lib/middleware"
+)
+
+// values of X-Cache header
+const (
+	headerXCache      = "X-Cache"
+	cacheHit          = "HIT"
+	cacheMiss         = "MISS"
+	cacheRevalidated  = "REVALIDATED"
+	cacheBypass       = "BYPASS"
+	headerCacheCtl    = "Cache-Control"
+	headerETag        = "ETag"
+	headerLastMod     = "Last-Modified"
+	headerIfNoneMatch = "If-None-Match"
+	headerIfModSince  = "If-Modified-Since"
+)
+
+// cache caches the responses of a service
+type cache struct {
+	service string
+	conf    Config
+	store   Store
+}
+
+// key returns the cache key of the request
+func (c *cache) key(r *http.Request) string {
+	var b strings.Builder
+	b.WriteString(strings.ToLower(r.Host))
+	b.WriteString(r.URL.Path)
+	if !c.conf.IgnoreQuery {
+		// encoding sorts the params, so that their order does not matter
+		b.WriteString("?")
+		b.WriteString(r.URL.Query().Encode())
+	}
+	for _, h := range c.conf.KeyHeaders {
+		b.WriteString("|" + h + "=" + r.Header.Get(h))
+	}
+	if c.conf.KeyConsumer {
+		if cons, ok := consumer.FromCtx(r.Context()); ok {
+			b.WriteString("|consumer=" + cons.Name)
+		}
+	}
+	return b.String()
+}
+
+// varyKey returns the key of the response varying on the given headers
+func varyKey(key string, vary []string, r *http.Request) string {
+	var b strings.Builder
+	b.WriteString(key)
+	for _, h := range vary {
+		b.WriteString("|vary:" + h + "=" + strings.Join(r.Header.Values(h), ","))
+	}
+	return b.String()
+}
+
+// lookup returns the entry cached for the request
+func (c *cache) lookup(key string, r *http.Request) (*Entry, bool) {
+	entry, found := c.store.Get(key)
+	if !found || entry.Vary == nil {
+		return entry, found
+	}
+	return c.store.Get(varyKey(key, entry.Vary, r))
+}
+
+func (c *cache) handler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		reqCC := parseCacheControl(r.Header.Get(headerCacheCtl))
+		if _, noStore := reqCC["no-store"]; noStore {
+			c.count(cacheBypass)
+			w.Header().Set(headerXCache, cacheBypass)
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		key := c.key(r)
+		entry, found := c.lookup(key, r)
+		_, noCache := reqCC["no-cache"]
+		if found && entry.fresh(time.Now()) && !noCache {
+			c.count(cacheHit)
+			serveEntry(w, r, entry, cacheHit)
+			return
+		}
+
+		// stale entries are revalidated with the upstream,
+		// unless the client has its own conditions
+		revalidate := found && r.Method == http.MethodGet &&
+			(entry.Header.Get(headerETag) != "" || entry.Header.Get(headerLastMod) != "") &&
+			r.Header.Get(headerIfNoneMatch) == "" && r.Header.Get(headerIfModSince) == ""
+
+		outReq := r
+		if revalidate {
+			outReq = r.Clone(r.Context())
+			if etag := entry.Header.Get(headerETag); etag != "" {
+				outReq.Header.Set(headerIfNoneMatch, etag)
+			}
+			if lastMod := entry.Header.Get(headerLastMod); lastMod != "" {
+				outReq.Header.Set(headerIfModSince, lastMod)
+			}
+		}
+
+		w.Header().Set(headerXCache, cacheMiss)
+		cw := newCaptureWriter(w, c.conf.MaxEntrySize, revalidate)
+		next.ServeHTTP(cw, outReq)
+
+		if cw.notModified {
+			// headers of 304 response update the stored headers. Stored
+			// entry can be in use by other requests, so it is copied
+			entry = entry.clone()
+			for k, values := range cw.header {
+				entry.Header[k] = values
+			}
+			if ttl, ok := c.ttl(entry.Status, entry.Header, r); ok {
+				entry.Stored = time.Now()
+				entry.Expires = entry.Stored.Add(ttl)
+				c.set(key, entry, r)
+			}
+			c.count(cacheRevalidated)
+			serveEntry(w, r, entry, cacheRevalidated)
+			return
+		}
+
+		c.count(cacheMiss)
+		if r.Method != http.MethodGet || !cw.complete() || r.Context().Err() != nil {
+			return
+		}
+		if ttl, ok := c.ttl(cw.status, cw.header, r); ok {
+			now := time.Now()
+			c.set(key, &Entry{
+				Path:    r.URL.Path,
+				Status:  cw.status,
+				Header:  cw.header,
+				Body:    cw.body.Bytes(),
+				Stored:  now,
+				Expires: now.Add(ttl),
+			}, r)
+		}
+	})
+}
+
+// set stores the entry. Entries of the responses varying on request
+// headers are stored along with a marker listing the headers
+func (c *cache) set(key string, entry *Entry, r *http.Request) {
+	var vary []string
+	for _, v := range entry.Header.Values("Vary") {
+		for _, h := range strings.Split(v, ",") {
+			if h = http.CanonicalHeaderKey(strings.TrimSpace(h)); h != "" {
+				vary = append(vary, h)
+			}
+		}
+	}
+	if len(vary) == 0 {
+		c.store.Set(key, entry)
+		return
+	}
+
+	sort.Strings(vary)
+	c.store.Set(key, &Entry{Path: entry.Path, Expires: entry.Expires, Vary: vary})
+	c.store.Set(varyKey(key, vary, r), entry)
+}
+
+// ttl returns how long the response can be cached for. The response can
+// be cached with zero ttl if it can be revalidated, so that stale entries
+// are revalidated instead of fetched again
+func (c *cache) ttl(status int, h http.Header, r *http.Request) (time.Duration, bool) {
+	if !containsInt(c.conf.StatusCodes, status) || h.Get("Set-Cookie") != "" {
+		return 0, false
+	}
+	for _, v := range h.Values("Vary") {
+		if strings.TrimSpace(v) == "*" {
+			return 0, false
+		}
+	}
+
+	cc := parseCacheControl(h.Get(headerCacheCtl))
+	if _, found := cc["no-store"]; found {
+		return 0, false
+	}
+	if _, found := cc["private"]; found {
+		return 0, false
+	}
+
+	// responses to authenticated requests are cached only if the upstream
+	// explicitly allows it, unless they are cached per consumer
+	_, hasConsumer := consumer.FromCtx(r.Context())
+	if (hasConsumer || r.Header.Get("Authorization") != "") && !(hasConsumer && c.conf.KeyConsumer) {
+		_, public := cc["public"]
+		_, sMaxAge := cc["s-maxage"]
+		if !public && !sMaxAge {
+			return 0, false
+		}
+	}
+
+	ttl := time.Duration(c.conf.TTL) * time.Second
+	if !c.conf.ForceTTL {
+		if _, found := cc["no-cache"]; found {
+			ttl = 0
+		} else if maxAge, found := seconds(cc, "s-maxage"); found {
+			ttl = maxAge
+		} else if maxAge, found := seconds(cc, "max-age"); found {
+			ttl = maxAge
+		} else if expires, err := http.ParseTime(h.Get("Expires")); err == nil {
+			ttl = time.Until(expires)
+		} else if h.Get("Expires") != "" {
+			// invalid Expires means already expired
+			ttl = 0
+		}
+	}
+	if maxTTL := time.Duration(c.conf.MaxTTL) * time.Second; maxTTL > 0 && ttl > maxTTL {
+		ttl = maxTTL
+	}
+
+	if ttl <= 0 {
+		return 0, h.Get(headerETag) != "" || h.Get(headerLastMod) != ""
+	}
+	return ttl, true
+}
+
+func (c *cache) count(status string) {
+	metrics.CacheRequests.With(c.service, status).Inc()
+}
+
+// serveEntry writes the cached response. Conditional requests of the
+// client are answered with 304 if the cached response satisfies them.
+// Stored headers are merged into the headers set for the current request
+func serveEntry(w http.ResponseWriter, r *http.Request, entry *Entry, status string) {
+	h := w.Header()
+	for k, values := range entry.Header {
+		h[k] = append([]string(nil), values...)
+	}
+	h.Set(headerXCache, status)
+	h.Set("Age", strconv.Itoa(int(time.Since(entry.Stored).Seconds())))
+
+	if notModified(r, entry.Header) {
+		h.Del("Content-Length")
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	w.WriteHeader(entry.Status)
+	if r.Method != http.MethodHead {
+		if _, err := w.Write(entry.Body); err != nil {
+			logger.FromCtx(r.Context()).Debug("cache: could not write response", "error", err)
+		}
+	}
+}
+
+// notModified reports if the conditional request is satisfied by the cached response
+func notModified(r *http.Request, h http.Header) bool {
+	if inm := r.Header.Get(headerIfNoneMatch); inm != "" {
+		etag := h.Get(headerETag)
+		for _, tag := range strings.Split(inm, ",") {
+			tag = strings.TrimSpace(tag)
+			if tag == "*" && etag != "" ||
+				etag != "" && strings.TrimPrefix(tag, "W/") == strings.TrimPrefix(etag, "W/") {
+				return true
+			}
+		}
+		return false
+	}
+
+	ims, err := http.ParseTime(r.Header.Get(headerIfModSince))
+	if err != nil {
+		return false
+	}
+	lastMod, err := http.ParseTime(h.Get(headerLastMod))
+	return err == nil && !lastMod.After(ims)
+}
+
+// parseCacheControl parses the Cache-Control header into directives and their values
+func parseCacheControl(header string) map[string]string {
+	directives := map[string]string{}
+	for _, part := range strings.Split(header, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		name, value := part, ""
+		if i := strings.Index(part, "="); i >= 0 {
+			name, value = part[:i], strings.Trim(part[i+1:], `"`)
+		}
+		directives[strings.ToLower(name)] = value
+	}
+	return directives
+}
+
+func seconds(directives map[string]string, name string) (time.Duration, bool) {
+	value, found := directives[name]
+	if !found {
+		return 0, false
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, true
+	}
+	return time.Duration(n) * time.Second, true
+}
+
+// captureWriter writes the response to the client while capturing it,
+// so that it can be cached. If swallow304 is set, 304 response to the
+// revalidation request is not written, to let the cached response be served
+type captureWriter struct {
+	*middleware.HeaderWriter
+	limit      int64
+	swallow304 bool
+
+	// gateway are the headers set before the request is passed on,
+	// like the request id and the rate limits. They belong to
+	// the request being served, so they are not captured
+	gateway map[string]bool
+
+	status      int
+	header      http.Header
+	body        bytes.Buffer
+	tooLarge    bool
+	notModified bool
+}
+
+func newCaptureWriter(w http.ResponseWriter, limit int64, swallow304 bool) *captureWriter {
+	cw := &captureWriter{limit: limit, swallow304: swallow304, gateway: map[string]bool{}}
+	for k := range w.Header() {
+		cw.gateway[k] = true
+	}
+	cw.HeaderWriter = middleware.NewHeaderWriter(w, cw.capture)
+	return cw
+}
+
+// capture captures the status and the headers of the upstream about to be written
+func (w *captureWriter) capture(h http.Header, status int) {
+	w.status = status
+	w.header = make(http.Header, len(h))
+	for k, values := range h {
+		if !w.gateway[k] {
+			w.header[k] = append([]string(nil), values...)
+		}
+	}
+}
+
+func (w *captureWriter) WriteHeader(status int) {
+	if w.status != 0 {
+		return
+	}
+	if w.swallow304 && status == http.StatusNotModified {
+		w.capture(w.Header(), status)
+		w.notModified = true
+		return
+	}
+	w.HeaderWriter.WriteHeader(status)
+}
+
+func (w *captureWriter) Write(b []byte) (int, error) {
+	if w.notModified {
+		return len(b), nil
+	}
+
+	n, err := w.HeaderWriter.Write(b)
+	if !w.tooLarge {
+		if int64(w.body.Len()+n) > w.limit {
+			w.tooLarge = true
+			w.body = bytes.Buffer{}
+		} else {
+			w.body.Write(b[:n])
+		}
+	}
+	return n, err
+}
+
+// complete reports if the whole response is captured
+func (w *captureWriter) complete() bool {
+	return w.status != 0 && !w.tooLarge && !w.notModified
+}
+
+// Flush sends any buffered data to the client
+func (w *captureWriter) Flush() {
+	if !w.notModified {
+		w.HeaderWriter.Flush()
+	}
+}
+
+// Hijack lets the caller take over the connection
+func (w *captureWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	w.tooLarge = true // hijacked responses are not cached
+	return w.HeaderWriter.Hijack()
+}
+
+func containsInt(values []int, value int) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,130 @@
+package cache
+
+import (
+	"crypto/sha256"
+	"encoding/gob"
+	"encoding/hex"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/AyushSenapati/guardian/lib/logger"
+)
+
+const diskEntryExt = ".cache"
+
+// diskStore keeps the entries in files of a directory. Index of
+// the entries is kept in memory, so that entries can be evicted
+// in least recently used order once the max size is exceeded
+type diskStore struct {
+	dir string
+
+	mu     sync.Mutex
+	lru    *lru
+	closed bool
+}
+
+// newDiskStore returns a store keeping the entries in a new dir created in
+// the given dir, so that it never shares the files with another instance
+func newDiskStore(parent string, maxSize int64) (*diskStore, error) {
+	if err := os.MkdirAll(parent, 0755); err != nil {
+		return nil, err
+	}
+	dir, err := ioutil.TempDir(parent, "store-")
+	if err != nil {
+		return nil, err
+	}
+
+	s := &diskStore{dir: dir}
+	s.lru = newLRU(maxSize, func(item *lruItem) {
+		if err := os.Remove(s.file(item.key)); err != nil && !os.IsNotExist(err) {
+			logger.Warn("cache: could not remove entry", "file", s.file(item.key), "error", err)
+		}
+	})
+	return s, nil
+}
+
+// close removes the dir of the store. Requests in flight
+// using the store miss the entries, and do not store new ones
+func (s *diskStore) close() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.closed = true
+	if err := os.RemoveAll(s.dir); err != nil {
+		logger.Warn("cache: could not remove cache dir", "dir", s.dir, "error", err)
+	}
+}
+
+// file returns the path of the file of the entry
+func (s *diskStore) file(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return filepath.Join(s.dir, hex.EncodeToString(sum[:])+diskEntryExt)
+}
+
+func (s *diskStore) Get(key string) (*Entry, bool) {
+	s.mu.Lock()
+	_, found := s.lru.get(key)
+	s.mu.Unlock()
+	if !found {
+		return nil, false
+	}
+
+	f, err := os.Open(s.file(key))
+	if err != nil {
+		return nil, false
+	}
+	defer f.Close()
+
+	var entry Entry
+	if err := gob.NewDecoder(f).Decode(&entry); err != nil {
+		logger.Warn("cache: could not read entry", "file", f.Name(), "error", err)
+		return nil, false
+	}
+	return &entry, true
+}
+
+func (s *diskStore) Set(key string, entry *Entry) {
+	s.mu.Lock()
+	closed := s.closed
+	s.mu.Unlock()
+	if closed {
+		return
+	}
+
+	// entry is written to a temp file and renamed,
+	// so that readers never see a partially written entry
+	tmp, err := ioutil.TempFile(s.dir, "entry-*.tmp")
+	if err != nil {
+		logger.Warn("cache: could not write entry", "error", err)
+		return
+	}
+	err = gob.NewEncoder(tmp).Encode(entry)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), s.file(key))
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		logger.Warn("cache: could not write entry", "error", err)
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		os.Remove(s.file(key))
+		return
+	}
+	s.lru.add(&lruItem{key: key, path: entry.Path, size: entry.size()})
+}
+
+func (s *diskStore) Purge(prefix string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.lru.purge(prefix)
+}
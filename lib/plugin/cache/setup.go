@@ -0,0 +1,165 @@
+package cache
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/AyushSenapati/guardian/lib/plugin/pluginconf"
+	"github.com/AyushSenapati/guardian/lib/proxy"
+)
+
+// supported storages
+const (
+	StorageMemory = "memory"
+	StorageDisk   = "disk"
+)
+
+// defaults of cache plugin config
+const (
+	defaultTTL          = 60 // in second(s)
+	defaultMaxSize      = 64 << 20
+	defaultMaxEntrySize = 1 << 20
+)
+
+// status codes cacheable by default
+var defaultStatusCodes = []int{
+	http.StatusOK, http.StatusNonAuthoritativeInfo, http.StatusMultipleChoices,
+	http.StatusMovedPermanently, http.StatusNotFound, http.StatusGone,
+}
+
+// Config defines cache plugin config
+type Config struct {
+	// TTL is used when the response does not define its freshness, in second(s)
+	TTL int `json:"ttl"`
+	// MaxTTL caps the freshness defined by the response, in second(s)
+	MaxTTL int `json:"max_ttl"`
+	// ForceTTL ignores the freshness defined by the response and uses TTL
+	ForceTTL    bool  `json:"force_ttl"`
+	StatusCodes []int `json:"status_codes"`
+	// IgnoreQuery leaves the query params out of the cache key
+	IgnoreQuery bool `json:"ignore_query"`
+	// KeyHeaders are the request headers added to the cache key
+	KeyHeaders []string `json:"key_headers"`
+	// KeyConsumer adds the authenticated consumer to the cache key, which lets
+	// the responses to the consumers be cached without being marked public
+	KeyConsumer bool `json:"key_consumer"`
+	// Storage can be memory or disk. Defaults to memory
+	Storage string `json:"storage"`
+	// Dir is where disk storage keeps the entries, in a dir of its own per
+	// instance of the plugin. Defaults to guardian-cache/<service> in temp dir
+	Dir string `json:"dir"`
+	// MaxSize of all the entries, in bytes. Defaults to 64MiB
+	MaxSize int64 `json:"max_size"`
+	// MaxEntrySize of a response to be cached, in bytes. Defaults to 1MiB
+	MaxEntrySize int64 `json:"max_entry_size"`
+}
+
+// caches keeps the cache of every service, so that they can be purged
+var caches = struct {
+	sync.RWMutex
+	m map[string]*cache
+}{m: make(map[string]*cache)}
+
+// SetupCache implements the logic to read the provided raw config and configure itself
+func SetupCache(def *proxy.RouterDefinition, rawConfig map[string]interface{}) error {
+	var config Config
+	if err := pluginconf.Decode(rawConfig, &config); err != nil {
+		return err
+	}
+
+	if err := config.validate(); err != nil {
+		return err
+	}
+	config.setDefaults(def.Name)
+
+	var store Store
+	if config.Storage == StorageDisk {
+		s, err := newDiskStore(config.Dir, config.MaxSize)
+		if err != nil {
+			return fmt.Errorf("could not create cache dir in `%s` [%s]", config.Dir, err)
+		}
+		def.OnClose(s.close)
+		store = s
+	} else {
+		store = newMemoryStore(config.MaxSize)
+	}
+
+	// cache can be purged only once it serves the requests
+	c := &cache{service: def.Name, conf: config, store: store}
+	def.OnCommit(c.publish)
+	def.OnClose(c.unpublish)
+
+	def.AddMiddleware(c.handler)
+	return nil
+}
+
+// publish makes the cache the one purged for its service
+func (c *cache) publish() {
+	caches.Lock()
+	defer caches.Unlock()
+
+	caches.m[c.service] = c
+}
+
+// unpublish removes the cache, unless it has been replaced already
+func (c *cache) unpublish() {
+	caches.Lock()
+	defer caches.Unlock()
+
+	if caches.m[c.service] == c {
+		delete(caches.m, c.service)
+	}
+}
+
+// Purge removes the cached responses of the service which request
+// path starts with the prefix. It returns the number of removed
+// entries and false if the service does not have a cache
+func Purge(service, prefix string) (int, bool) {
+	caches.RLock()
+	c, found := caches.m[service]
+	caches.RUnlock()
+	if !found {
+		return 0, false
+	}
+	return c.store.Purge(prefix), true
+}
+
+func (c *Config) validate() error {
+	if c.TTL < 0 || c.MaxTTL < 0 || c.MaxSize < 0 || c.MaxEntrySize < 0 {
+		return errors.New("cache values can not be negative")
+	}
+	switch c.Storage {
+	case "", StorageMemory, StorageDisk:
+	default:
+		return fmt.Errorf("unsupported cache storage `%s`, should be of (memory/disk)", c.Storage)
+	}
+	return nil
+}
+
+func (c *Config) setDefaults(service string) {
+	if c.TTL == 0 {
+		c.TTL = defaultTTL
+	}
+	if len(c.StatusCodes) == 0 {
+		c.StatusCodes = defaultStatusCodes
+	}
+	if c.Storage == "" {
+		c.Storage = StorageMemory
+	}
+	if c.Storage == StorageDisk && c.Dir == "" {
+		c.Dir = filepath.Join(os.TempDir(), "guardian-cache", service)
+	}
+	if c.MaxSize == 0 {
+		c.MaxSize = defaultMaxSize
+	}
+	if c.MaxEntrySize == 0 {
+		c.MaxEntrySize = defaultMaxEntrySize
+	}
+	for i, h := range c.KeyHeaders {
+		c.KeyHeaders[i] = http.CanonicalHeaderKey(h)
+	}
+}
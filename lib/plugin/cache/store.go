@@ -0,0 +1,166 @@
+package cache
+
+import (
+	"container/list"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Entry is a cached response
+type Entry struct {
+	// Path of the request, used to purge the entries
+	Path    string
+	Status  int
+	Header  http.Header
+	Body    []byte
+	Stored  time.Time
+	Expires time.Time
+	// Vary lists the headers the response varies on. Entry having it is a
+	// marker, which tells the key of the response to include their values
+	Vary []string
+}
+
+func (e *Entry) fresh(now time.Time) bool {
+	return now.Before(e.Expires)
+}
+
+// clone returns a copy of the entry which headers can be modified.
+// Body is shared as it is never modified
+func (e *Entry) clone() *Entry {
+	c := *e
+	c.Header = e.Header.Clone()
+	return &c
+}
+
+// size estimates the memory used by the entry in bytes
+func (e *Entry) size() int64 {
+	size := int64(len(e.Path) + len(e.Body))
+	for k, values := range e.Header {
+		for _, v := range values {
+			size += int64(len(k) + len(v))
+		}
+	}
+	for _, v := range e.Vary {
+		size += int64(len(v))
+	}
+	return size
+}
+
+// Store stores the cached responses
+type Store interface {
+	Get(key string) (*Entry, bool)
+	Set(key string, entry *Entry)
+	// Purge removes the entries which request path starts
+	// with the prefix and returns the number of removed entries
+	Purge(prefix string) int
+}
+
+// lru keeps the items in the order they are used and evicts the least
+// recently used ones when size of the items exceeds the max size
+type lru struct {
+	maxSize int64
+	size    int64
+	ll      *list.List
+	items   map[string]*list.Element
+	onEvict func(*lruItem)
+}
+
+type lruItem struct {
+	key   string
+	path  string
+	size  int64
+	value interface{}
+}
+
+func newLRU(maxSize int64, onEvict func(*lruItem)) *lru {
+	return &lru{
+		maxSize: maxSize,
+		ll:      list.New(),
+		items:   make(map[string]*list.Element),
+		onEvict: onEvict,
+	}
+}
+
+func (l *lru) get(key string) (*lruItem, bool) {
+	el, found := l.items[key]
+	if !found {
+		return nil, false
+	}
+	l.ll.MoveToFront(el)
+	return el.Value.(*lruItem), true
+}
+
+// add adds the item, replacing the item of same key if any
+func (l *lru) add(item *lruItem) {
+	if el, found := l.items[item.key]; found {
+		l.size += item.size - el.Value.(*lruItem).size
+		el.Value = item
+		l.ll.MoveToFront(el)
+	} else {
+		l.items[item.key] = l.ll.PushFront(item)
+		l.size += item.size
+	}
+
+	for l.size > l.maxSize && l.ll.Len() > 0 {
+		l.removeElement(l.ll.Back())
+	}
+}
+
+func (l *lru) purge(prefix string) int {
+	var purged int
+	for el := l.ll.Front(); el != nil; {
+		next := el.Next()
+		if strings.HasPrefix(el.Value.(*lruItem).path, prefix) {
+			l.removeElement(el)
+			purged++
+		}
+		el = next
+	}
+	return purged
+}
+
+func (l *lru) removeElement(el *list.Element) {
+	item := l.ll.Remove(el).(*lruItem)
+	delete(l.items, item.key)
+	l.size -= item.size
+	if l.onEvict != nil {
+		l.onEvict(item)
+	}
+}
+
+// memoryStore keeps the entries in memory
+type memoryStore struct {
+	mu  sync.Mutex
+	lru *lru
+}
+
+func newMemoryStore(maxSize int64) *memoryStore {
+	return &memoryStore{lru: newLRU(maxSize, nil)}
+}
+
+func (s *memoryStore) Get(key string) (*Entry, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	item, found := s.lru.get(key)
+	if !found {
+		return nil, false
+	}
+	return item.value.(*Entry), true
+}
+
+func (s *memoryStore) Set(key string, entry *Entry) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.lru.add(&lruItem{key: key, path: entry.Path, size: entry.size(), value: entry})
+}
+
+func (s *memoryStore) Purge(prefix string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.lru.purge(prefix)
+}
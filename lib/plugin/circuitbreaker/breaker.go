@@ -0,0 +1,158 @@
+package circuitbreaker
+
+import (
+	"sync"
+	"time"
+
+	"github.com/AyushSenapati/guardian/lib/logger"
+	"github.com/AyushSenapati/guardian/lib/metrics"
+)
+
+// state of the circuit
+type state int
+
+const (
+	closed state = iota
+	open
+	halfOpen
+)
+
+func (s state) String() string {
+	switch s {
+	case open:
+		return "open"
+	case halfOpen:
+		return "half-open"
+	default:
+		return "closed"
+	}
+}
+
+// breaker tracks the failures of the upstream of a service
+type breaker struct {
+	service string
+	conf    Config
+
+	mu    sync.Mutex
+	state state
+	// openedAt is the time circuit was last opened
+	openedAt time.Time
+
+	// counters of the current window, used when the circuit is closed
+	windowStart time.Time
+	requests    int
+	failures    int
+	consecutive int
+
+	// probes let through and succeeded, used when the circuit is half-open
+	probes    int
+	successes int
+}
+
+func newBreaker(service string, conf Config) *breaker {
+	return &breaker{service: service, conf: conf, windowStart: time.Now()}
+}
+
+// report sets the state gauge of the service to the state of the circuit
+func (b *breaker) report() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	metrics.CircuitBreakerState.With(b.service).Set(float64(b.state))
+}
+
+// allow reports if the request can be passed on to the upstream
+func (b *breaker) allow() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case open:
+		if time.Since(b.openedAt) < time.Duration(b.conf.OpenDuration)*time.Second {
+			return false
+		}
+		b.transition(halfOpen)
+		fallthrough
+
+	case halfOpen:
+		if b.probes >= b.conf.HalfOpenRequests {
+			return false
+		}
+		b.probes++
+	}
+	return true
+}
+
+// release gives back the probe of a request which result is not recorded
+func (b *breaker) release() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.state == halfOpen && b.probes > 0 {
+		b.probes--
+	}
+}
+
+// record records the result of a request passed on to the upstream
+func (b *breaker) record(ok bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case halfOpen:
+		if !ok {
+			b.transition(open)
+			return
+		}
+		b.successes++
+		if b.successes >= b.conf.HalfOpenRequests {
+			b.transition(closed)
+		}
+
+	case closed:
+		if time.Since(b.windowStart) >= time.Duration(b.conf.Window)*time.Second {
+			b.windowStart = time.Now()
+			b.requests, b.failures = 0, 0
+		}
+
+		b.requests++
+		if ok {
+			b.consecutive = 0
+			return
+		}
+		b.failures++
+		b.consecutive++
+
+		if b.conf.ConsecutiveFailures > 0 && b.consecutive >= b.conf.ConsecutiveFailures {
+			b.transition(open)
+			return
+		}
+		if b.conf.ErrorRatio > 0 && b.requests >= b.conf.MinRequests &&
+			float64(b.failures)/float64(b.requests) >= b.conf.ErrorRatio {
+			b.transition(open)
+		}
+	}
+}
+
+// transition moves the circuit to the given state, caller must hold the lock
+func (b *breaker) transition(to state) {
+	from := b.state
+	b.state = to
+	b.probes, b.successes = 0, 0
+
+	switch to {
+	case open:
+		b.openedAt = time.Now()
+		logger.Warn("circuit-breaker: circuit opened", "service", b.service, "from", from,
+			"failures", b.failures, "requests", b.requests, "consecutive_failures", b.consecutive)
+	case halfOpen:
+		logger.Info("circuit-breaker: circuit half-opened", "service", b.service)
+	case closed:
+		b.windowStart = time.Now()
+		b.requests, b.failures, b.consecutive = 0, 0, 0
+		logger.Info("circuit-breaker: circuit closed", "service", b.service)
+	}
+
+	metrics.CircuitBreakerState.With(b.service).Set(float64(to))
+	metrics.CircuitBreakerTransitions.With(b.service, to.String()).Inc()
+}
@@ -0,0 +1,186 @@
+package circuitbreaker
+
+import (
+	"errors"
+	"net/http"
+	"reflect"
+	"sync"
+
+	"github.com/AyushSenapati/guardian/lib/metrics"
+	"github.com/AyushSenapati/guardian/lib/middleware"
+	"github.com/AyushSenapati/guardian/lib/plugin/pluginconf"
+	"github.com/AyushSenapati/guardian/lib/proxy"
+)
+
+// defaults of circuit-breaker plugin config
+const (
+	defaultConsecutiveFailures = 5
+	defaultMinRequests         = 20
+	defaultWindow              = 10 // in second(s)
+	defaultOpenDuration        = 30 // in second(s)
+	defaultHalfOpenRequests    = 1
+	defaultFallbackBody        = "Service temporarily unavailable"
+	defaultFallbackType        = "text/plain; charset=utf-8"
+)
+
+// Config defines circuit-breaker plugin config.
+// The circuit opens once either of the thresholds is reached.
+// If none of them is configured, it opens after 5 consecutive failures
+type Config struct {
+	// ErrorRatio of failed requests in the window, in between 0 and 1
+	ErrorRatio float64 `json:"error_ratio"`
+	// MinRequests to be served in the window before error ratio is considered
+	MinRequests         int `json:"min_requests"`
+	ConsecutiveFailures int `json:"consecutive_failures"`
+	Window              int `json:"window"` // in second(s)
+	// OpenDuration is the time circuit stays open before probing the upstream
+	OpenDuration int `json:"open_duration"` // in second(s)
+	// HalfOpenRequests are let through to probe the upstream.
+	// The circuit closes once all of them succeed
+	HalfOpenRequests int `json:"half_open_requests"`
+	// FailureStatusCodes are the response status codes considered as failure.
+	// Defaults to all 5xx status codes
+	FailureStatusCodes  []int  `json:"failure_status_codes"`
+	FallbackBody        string `json:"fallback_body"`
+	FallbackContentType string `json:"fallback_content_type"`
+}
+
+// SetupCircuitBreaker implements the logic to read the provided raw config and configure itself
+func SetupCircuitBreaker(def *proxy.RouterDefinition, rawConfig map[string]interface{}) error {
+	var config Config
+	if err := pluginconf.Decode(rawConfig, &config); err != nil {
+		return err
+	}
+
+	if err := config.validate(); err != nil {
+		return err
+	}
+	config.setDefaults()
+
+	// breaker is published once the service serves requests, so that
+	// a rejected reload neither reports its state nor replaces the live one
+	reg := &registration{proxy: *def.Definition, config: config}
+	reg.breaker = reg.current(def.Name)
+	def.OnCommit(reg.publish)
+	def.OnClose(reg.unpublish)
+
+	def.AddMiddleware(protect(reg.breaker, config))
+	return nil
+}
+
+// breakers keeps the breaker in use of every service, so that the state of
+// the circuit survives the reloads which leave the service unchanged
+var breakers = struct {
+	sync.Mutex
+	m map[string]*registration
+}{m: make(map[string]*registration)}
+
+// registration is the breaker of a service along with
+// the definitions it was set up with
+type registration struct {
+	breaker *breaker
+	proxy   proxy.Definition
+	config  Config
+}
+
+// current returns the breaker in use if the upstream and the config of the
+// service are unchanged, otherwise a new breaker with the circuit closed
+func (reg *registration) current(service string) *breaker {
+	breakers.Lock()
+	defer breakers.Unlock()
+
+	if live, found := breakers.m[service]; found &&
+		reflect.DeepEqual(live.proxy, reg.proxy) && reflect.DeepEqual(live.config, reg.config) {
+		return live.breaker
+	}
+	return newBreaker(service, reg.config)
+}
+
+// publish makes the breaker the one in use for its service
+func (reg *registration) publish() {
+	breakers.Lock()
+	defer breakers.Unlock()
+
+	breakers.m[reg.breaker.service] = reg
+	reg.breaker.report()
+}
+
+// unpublish removes the breaker, unless it has been replaced already
+func (reg *registration) unpublish() {
+	breakers.Lock()
+	defer breakers.Unlock()
+
+	if breakers.m[reg.breaker.service] == reg {
+		delete(breakers.m, reg.breaker.service)
+	}
+}
+
+func (c *Config) validate() error {
+	if c.ErrorRatio < 0 || c.ErrorRatio > 1 {
+		return errors.New("error_ratio must be in between 0 and 1")
+	}
+	if c.MinRequests < 0 || c.ConsecutiveFailures < 0 || c.Window < 0 ||
+		c.OpenDuration < 0 || c.HalfOpenRequests < 0 {
+		return errors.New("circuit-breaker values can not be negative")
+	}
+	return nil
+}
+
+func (c *Config) setDefaults() {
+	if c.ErrorRatio == 0 && c.ConsecutiveFailures == 0 {
+		c.ConsecutiveFailures = defaultConsecutiveFailures
+	}
+	setDefault(&c.MinRequests, defaultMinRequests)
+	setDefault(&c.Window, defaultWindow)
+	setDefault(&c.OpenDuration, defaultOpenDuration)
+	setDefault(&c.HalfOpenRequests, defaultHalfOpenRequests)
+	if c.FallbackBody == "" {
+		c.FallbackBody = defaultFallbackBody
+	}
+	if c.FallbackContentType == "" {
+		c.FallbackContentType = defaultFallbackType
+	}
+}
+
+func setDefault(value *int, def int) {
+	if *value == 0 {
+		*value = def
+	}
+}
+
+// isFailure reports if the response status is considered as failure
+func (c *Config) isFailure(status int) bool {
+	if len(c.FailureStatusCodes) == 0 {
+		return status >= http.StatusInternalServerError
+	}
+	for _, code := range c.FailureStatusCodes {
+		if code == status {
+			return true
+		}
+	}
+	return false
+}
+
+func protect(b *breaker, config Config) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if !b.allow() {
+				metrics.CircuitBreakerRejections.With(b.service).Inc()
+				w.Header().Set("Content-Type", config.FallbackContentType)
+				w.WriteHeader(http.StatusServiceUnavailable)
+				w.Write([]byte(config.FallbackBody))
+				return
+			}
+
+			rw := middleware.NewResponseWriter(w)
+			next.ServeHTTP(rw, r)
+
+			// requests canceled by the client say nothing about the upstream
+			if r.Context().Err() != nil {
+				b.release()
+				return
+			}
+			b.record(!config.isFailure(rw.Status()))
+		})
+	}
+}
@@ -0,0 +1,248 @@
+package cors
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/AyushSenapati/guardian/lib/middleware"
+	"github.com/AyushSenapati/guardian/lib/plugin/pluginconf"
+	"github.com/AyushSenapati/guardian/lib/proxy"
+)
+
+// CORS headers
+const (
+	headerOrigin           = "Origin"
+	headerRequestMethod    = "Access-Control-Request-Method"
+	headerRequestHeaders   = "Access-Control-Request-Headers"
+	headerAllowOrigin      = "Access-Control-Allow-Origin"
+	headerAllowMethods     = "Access-Control-Allow-Methods"
+	headerAllowHeaders     = "Access-Control-Allow-Headers"
+	headerAllowCredentials = "Access-Control-Allow-Credentials"
+	headerExposeHeaders    = "Access-Control-Expose-Headers"
+	headerMaxAge           = "Access-Control-Max-Age"
+)
+
+var defaultMethods = []string{
+	http.MethodGet, http.MethodHead, http.MethodPut,
+	http.MethodPatch, http.MethodPost, http.MethodDelete,
+}
+
+// Config defines cors plugin config
+type Config struct {
+	// AllowOrigins can have exact origins like https://example.com,
+	// origins with a wildcard like https://*.example.com, * to allow
+	// any origin and regex starting with ~, which has to match the whole
+	// origin. Defaults to *, which can not be used with AllowCredentials
+	AllowOrigins []string `json:"allow_origins"`
+	// AllowMethods defaults to GET, HEAD, PUT, PATCH, POST and DELETE
+	AllowMethods []string `json:"allow_methods"`
+	// AllowHeaders defaults to the headers requested by the preflight request
+	AllowHeaders     []string `json:"allow_headers"`
+	ExposeHeaders    []string `json:"expose_headers"`
+	AllowCredentials bool     `json:"allow_credentials"`
+	// MaxAge is the time preflight response can be cached for, in second(s)
+	MaxAge int `json:"max_age"`
+}
+
+// policy is the compiled cors config
+type policy struct {
+	anyOrigin   bool
+	origins     []string
+	patterns    []*regexp.Regexp
+	methods     []string
+	headers     []string
+	credentials bool
+	expose      string
+	maxAge      string
+}
+
+// SetupCORS implements the logic to read the provided raw config and configure itself
+func SetupCORS(def *proxy.RouterDefinition, rawConfig map[string]interface{}) error {
+	var config Config
+	if err := pluginconf.Decode(rawConfig, &config); err != nil {
+		return err
+	}
+
+	p, err := newPolicy(config)
+	if err != nil {
+		return err
+	}
+
+	def.AddMiddleware(handleCORS(p))
+	return nil
+}
+
+func newPolicy(config Config) (*policy, error) {
+	if config.MaxAge < 0 {
+		return nil, errors.New("max_age can not be negative")
+	}
+
+	p := &policy{
+		headers:     config.AllowHeaders,
+		credentials: config.AllowCredentials,
+		expose:      strings.Join(config.ExposeHeaders, ", "),
+	}
+	if config.MaxAge > 0 {
+		p.maxAge = strconv.Itoa(config.MaxAge)
+	}
+	// methods are copied, so that the shared defaults are never modified
+	methods := config.AllowMethods
+	if len(methods) == 0 {
+		methods = defaultMethods
+	}
+	p.methods = make([]string, 0, len(methods))
+	for _, m := range methods {
+		p.methods = append(p.methods, strings.ToUpper(m))
+	}
+
+	if len(config.AllowOrigins) == 0 {
+		p.anyOrigin = true
+	}
+	for _, origin := range config.AllowOrigins {
+		switch {
+		case origin == "*":
+			p.anyOrigin = true
+
+		case strings.HasPrefix(origin, "~"):
+			// regex has to match the whole origin, so that it is not
+			// matched by the origins having it as a prefix or suffix
+			re, err := regexp.Compile("^(?:" + origin[1:] + ")$")
+			if err != nil {
+				return nil, fmt.Errorf("invalid origin regex `%s` [%s]", origin, err)
+			}
+			p.patterns = append(p.patterns, re)
+
+		case strings.Contains(origin, "*"):
+			if strings.Count(origin, "*") > 1 {
+				return nil, fmt.Errorf("invalid origin `%s`, only one wildcard is allowed", origin)
+			}
+			expr := strings.Replace(regexp.QuoteMeta(origin), `\*`, `[^./]+(\.[^./]+)*`, 1)
+			p.patterns = append(p.patterns, regexp.MustCompile("^"+expr+"$"))
+
+		default:
+			p.origins = append(p.origins, strings.ToLower(origin))
+		}
+	}
+
+	// browsers do not accept "*" along with credentials. Reflecting any
+	// origin instead would let any site make credentialed requests
+	if p.anyOrigin && p.credentials {
+		return nil, errors.New("allow_credentials requires allow_origins to list the origins, * is not allowed")
+	}
+	return p, nil
+}
+
+func (p *policy) allowOrigin(origin string) bool {
+	if p.anyOrigin {
+		return true
+	}
+	for _, o := range p.origins {
+		if o == strings.ToLower(origin) {
+			return true
+		}
+	}
+	for _, re := range p.patterns {
+		if re.MatchString(origin) {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *policy) allowMethod(method string) bool {
+	for _, m := range p.methods {
+		if m == method {
+			return true
+		}
+	}
+	return false
+}
+
+// originHeaders sets the headers common to the preflight and actual responses
+func (p *policy) originHeaders(h http.Header, origin string) {
+	if p.anyOrigin {
+		h.Set(headerAllowOrigin, "*")
+	} else {
+		h.Set(headerAllowOrigin, origin)
+		addVary(h, headerOrigin)
+	}
+	if p.credentials {
+		h.Set(headerAllowCredentials, "true")
+	}
+}
+
+func handleCORS(p *policy) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			origin := r.Header.Get(headerOrigin)
+			if origin == "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			if r.Method == http.MethodOptions && r.Header.Get(headerRequestMethod) != "" {
+				preflight(w, r, p, origin)
+				return
+			}
+
+			// cors headers of the upstream are overridden, so
+			// that the response carries only the gateway's cors policy
+			allowed := p.allowOrigin(origin)
+			cw := middleware.NewHeaderWriter(w, func(h http.Header, _ int) {
+				h.Del(headerAllowOrigin)
+				h.Del(headerAllowCredentials)
+				h.Del(headerExposeHeaders)
+				if !allowed {
+					return
+				}
+				p.originHeaders(h, origin)
+				if p.expose != "" {
+					h.Set(headerExposeHeaders, p.expose)
+				}
+			})
+			next.ServeHTTP(cw, r)
+			cw.Done()
+		})
+	}
+}
+
+// preflight answers the preflight request at the gateway
+func preflight(w http.ResponseWriter, r *http.Request, p *policy, origin string) {
+	h := w.Header()
+	addVary(h, headerOrigin)
+	addVary(h, headerRequestMethod)
+	addVary(h, headerRequestHeaders)
+
+	if !p.allowOrigin(origin) || !p.allowMethod(r.Header.Get(headerRequestMethod)) {
+		w.WriteHeader(http.StatusForbidden)
+		return
+	}
+
+	p.originHeaders(h, origin)
+	h.Set(headerAllowMethods, strings.Join(p.methods, ", "))
+	if len(p.headers) > 0 {
+		h.Set(headerAllowHeaders, strings.Join(p.headers, ", "))
+	} else if requested := r.Header.Get(headerRequestHeaders); requested != "" {
+		h.Set(headerAllowHeaders, requested)
+	}
+	if p.maxAge != "" {
+		h.Set(headerMaxAge, p.maxAge)
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// addVary adds the header to Vary unless it is already there
+func addVary(h http.Header, header string) {
+	for _, v := range h.Values("Vary") {
+		for _, name := range strings.Split(v, ",") {
+			if strings.EqualFold(strings.TrimSpace(name), header) {
+				return
+			}
+		}
+	}
+	h.Add("Vary", header)
+}
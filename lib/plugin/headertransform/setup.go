@@ -0,0 +1,186 @@
+package headertransform
+
+import (
+	"errors"
+	"net/http"
+	"sort"
+
+	"github.com/AyushSenapati/guardian/lib/middleware"
+	"github.com/AyushSenapati/guardian/lib/plugin/pluginconf"
+	"github.com/AyushSenapati/guardian/lib/proxy"
+)
+
+// Config defines header-transform plugin config
+type Config struct {
+	// Request is applied on the request proxied to the upstream
+	Request Transform `json:"request"`
+	// Response is applied on the response sent to the client
+	Response Transform `json:"response"`
+}
+
+// Transform defines the changes to the headers. They are applied in the
+// order remove, rename, set and add. Values of set and add can refer
+// to the request attributes using variables, e.g. "$(client_ip)".
+// Supported variables are client_ip, request_id, consumer, service,
+// method, host, path, header.<name>, query.<name>, param.<name>
+// for the named params of the listen path and env.<name>.
+// Headers which values resolve to empty are not set
+type Transform struct {
+	Remove []string `json:"remove"`
+	// Rename maps the headers to their new names
+	Rename map[string]string `json:"rename"`
+	// Set replaces the values of the headers
+	Set map[string]string `json:"set"`
+	// Add appends the values to the existing values of the headers
+	Add map[string]string `json:"add"`
+}
+
+type header struct {
+	name  string
+	value template
+}
+
+// transform is the compiled Transform
+type transform struct {
+	remove []string
+	rename [][2]string
+	set    []header
+	add    []header
+}
+
+// SetupHeaderTransform implements the logic to read the provided raw config and configure itself
+func SetupHeaderTransform(def *proxy.RouterDefinition, rawConfig map[string]interface{}) error {
+	var config Config
+	if err := pluginconf.Decode(rawConfig, &config); err != nil {
+		return err
+	}
+
+	reqTransform, err := compile(config.Request)
+	if err != nil {
+		return err
+	}
+	respTransform, err := compile(config.Response)
+	if err != nil {
+		return err
+	}
+
+	def.AddMiddleware(transformHeaders(reqTransform, respTransform))
+	return nil
+}
+
+func compile(conf Transform) (*transform, error) {
+	t := &transform{remove: conf.Remove}
+
+	for _, from := range sortedKeys(conf.Rename) {
+		to := conf.Rename[from]
+		if from == "" || to == "" {
+			return nil, errors.New("header name to rename can not be blank")
+		}
+		t.rename = append(t.rename, [2]string{from, to})
+	}
+
+	var err error
+	if t.set, err = compileHeaders(conf.Set); err != nil {
+		return nil, err
+	}
+	if t.add, err = compileHeaders(conf.Add); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+func compileHeaders(headers map[string]string) ([]header, error) {
+	var compiled []header
+	for _, name := range sortedKeys(headers) {
+		if name == "" {
+			return nil, errors.New("header name can not be blank")
+		}
+		value, err := parseTemplate(headers[name])
+		if err != nil {
+			return nil, err
+		}
+		compiled = append(compiled, header{name: name, value: value})
+	}
+	return compiled, nil
+}
+
+// it sorts the keys, so that the transform is applied in a deterministic order
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// values are the resolved values of the headers to be set and added
+type values struct {
+	set []string
+	add []string
+}
+
+// resolve resolves the values of the headers to be set and added from the request
+func (t *transform) resolve(r *http.Request) values {
+	v := values{set: make([]string, len(t.set)), add: make([]string, len(t.add))}
+	for i, s := range t.set {
+		v.set[i] = s.value.execute(r)
+	}
+	for i, a := range t.add {
+		v.add[i] = a.value.execute(r)
+	}
+	return v
+}
+
+// apply applies the transform on the headers. Variables are resolved from the request
+func (t *transform) apply(h http.Header, r *http.Request) {
+	t.removeAndRename(h)
+	t.setAndAdd(h, t.resolve(r))
+}
+
+func (t *transform) removeAndRename(h http.Header) {
+	for _, name := range t.remove {
+		h.Del(name)
+	}
+
+	for _, rename := range t.rename {
+		if values := h.Values(rename[0]); len(values) > 0 {
+			h.Del(rename[0])
+			for _, v := range values {
+				h.Add(rename[1], v)
+			}
+		}
+	}
+}
+
+func (t *transform) setAndAdd(h http.Header, v values) {
+	for i, s := range t.set {
+		if v.set[i] != "" {
+			h.Set(s.name, v.set[i])
+		}
+	}
+
+	for i, a := range t.add {
+		if v.add[i] != "" {
+			h.Add(a.name, v.add[i])
+		}
+	}
+}
+
+func transformHeaders(reqTransform, respTransform *transform) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			// response headers are resolved from the request as received,
+			// so they are not affected by the request transform
+			respValues := respTransform.resolve(r)
+			reqTransform.apply(r.Header, r)
+
+			hw := middleware.NewHeaderWriter(w, func(h http.Header, _ int) {
+				respTransform.removeAndRename(h)
+				respTransform.setAndAdd(h, respValues)
+			})
+			next.ServeHTTP(hw, r)
+			hw.Done()
+		})
+	}
+}
@@ -0,0 +1,100 @@
+package headertransform
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/AyushSenapati/guardian/lib/consumer"
+	"github.com/AyushSenapati/guardian/lib/middleware"
+	"github.com/AyushSenapati/guardian/lib/realip"
+	"github.com/AyushSenapati/guardian/lib/router"
+)
+
+// variable matches the variables like $(client_ip) and $(header.Accept)
+var variable = regexp.MustCompile(`\$\(([a-z_]+)(?:\.([^)]+))?\)`)
+
+// resolver resolves the value of a variable from the request
+type resolver func(r *http.Request) string
+
+// variables which don't take a name
+var resolvers = map[string]resolver{
+	"client_ip": realip.ClientIP,
+	"request_id": func(r *http.Request) string {
+		return middleware.ReqIDFromCtx(r.Context())
+	},
+	"consumer": func(r *http.Request) string {
+		if c, ok := consumer.FromCtx(r.Context()); ok {
+			return c.Name
+		}
+		return ""
+	},
+	"service": func(r *http.Request) string {
+		return router.RouteFromCtx(r.Context()).Service
+	},
+	"method": func(r *http.Request) string { return r.Method },
+	"host":   func(r *http.Request) string { return r.Host },
+	"path":   func(r *http.Request) string { return r.URL.Path },
+}
+
+// variables which take a name, like $(env.HOME)
+var namedResolvers = map[string]func(name string) resolver{
+	"header": func(name string) resolver {
+		return func(r *http.Request) string { return r.Header.Get(name) }
+	},
+	"query": func(name string) resolver {
+		return func(r *http.Request) string { return r.URL.Query().Get(name) }
+	},
+	"param": func(name string) resolver {
+		return func(r *http.Request) string { return router.ParamsFromCtx(r.Context())[name] }
+	},
+	// env variables are resolved once when the plugin is set up
+	"env": func(name string) resolver {
+		value := os.Getenv(name)
+		return func(*http.Request) string { return value }
+	},
+}
+
+// template is a header value which may refer to the variables
+type template []resolver
+
+func parseTemplate(value string) (template, error) {
+	var t template
+	last := 0
+	for _, loc := range variable.FindAllStringSubmatchIndex(value, -1) {
+		if literal := value[last:loc[0]]; literal != "" {
+			t = append(t, func(*http.Request) string { return literal })
+		}
+		last = loc[1]
+
+		kind := value[loc[2]:loc[3]]
+		if loc[4] == -1 {
+			res, found := resolvers[kind]
+			if !found {
+				return nil, fmt.Errorf("unsupported variable `%s` in `%s`", kind, value)
+			}
+			t = append(t, res)
+			continue
+		}
+
+		newResolver, found := namedResolvers[kind]
+		if !found {
+			return nil, fmt.Errorf("unsupported variable `%s` in `%s`", kind, value)
+		}
+		t = append(t, newResolver(value[loc[4]:loc[5]]))
+	}
+	if literal := value[last:]; literal != "" {
+		t = append(t, func(*http.Request) string { return literal })
+	}
+	return t, nil
+}
+
+func (t template) execute(r *http.Request) string {
+	var b strings.Builder
+	for _, res := range t {
+		b.WriteString(res(r))
+	}
+	return b.String()
+}
@@ -0,0 +1,208 @@
+package iprestriction
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/AyushSenapati/guardian/lib/logger"
+	"github.com/AyushSenapati/guardian/lib/plugin/pluginconf"
+	"github.com/AyushSenapati/guardian/lib/proxy"
+	"github.com/AyushSenapati/guardian/lib/realip"
+	"github.com/AyushSenapati/guardian/lib/watcher"
+)
+
+// defaults of ip-restriction plugin config
+const (
+	defaultStatus        = http.StatusForbidden
+	defaultBody          = "Your IP address is not allowed"
+	defaultContentType   = "text/plain; charset=utf-8"
+	defaultWatchInterval = 2 // in second(s)
+)
+
+// Config defines ip-restriction plugin config. Deny list takes precedence
+// over allow list. If allow list is not empty, only the IPs in it are allowed
+type Config struct {
+	// Allow and Deny are the IPs or CIDRs, both IPv4 and IPv6
+	Allow []string `json:"allow"`
+	Deny  []string `json:"deny"`
+	// File is a JSON file having allow and deny lists, which are
+	// added to the lists of the config. It is reloaded whenever it changes
+	File string `json:"file"`
+	// WatchInterval is how often the file is checked for changes, in second(s)
+	WatchInterval int    `json:"watch_interval"`
+	Status        int    `json:"status"`
+	Body          string `json:"body"`
+	ContentType   string `json:"content_type"`
+}
+
+// lists is the content of the ip-restriction file
+type lists struct {
+	Allow []string `json:"allow"`
+	Deny  []string `json:"deny"`
+}
+
+// rules are the parsed allow and deny lists
+type rules struct {
+	allow []*net.IPNet
+	deny  []*net.IPNet
+}
+
+// restriction allows or denies the requests of a service by the client IP
+type restriction struct {
+	config Config
+	inline lists
+
+	mu    sync.RWMutex
+	rules *rules
+}
+
+// SetupIPRestriction implements the logic to read the provided raw config and configure itself
+func SetupIPRestriction(def *proxy.RouterDefinition, rawConfig map[string]interface{}) error {
+	var config Config
+	if err := pluginconf.Decode(rawConfig, &config); err != nil {
+		return err
+	}
+
+	if err := config.validate(); err != nil {
+		return err
+	}
+	config.setDefaults()
+
+	rs := &restriction{config: config, inline: lists{Allow: config.Allow, Deny: config.Deny}}
+	if err := rs.load(); err != nil {
+		return err
+	}
+
+	// file is watched only while the register having the plugin is in use
+	if config.File != "" {
+		w := watcher.New(
+			config.File, time.Duration(config.WatchInterval)*time.Second, func() {
+				if err := rs.load(); err != nil {
+					logger.Error("ip-restriction: could not reload file, keeping the old lists",
+						"service", def.Name, "error", err)
+					return
+				}
+				logger.Info("ip-restriction: file reloaded", "service", def.Name, "file", config.File)
+			},
+		)
+		def.OnCommit(w.Start)
+		def.OnClose(w.Stop)
+	}
+
+	def.AddMiddleware(rs.handler)
+	return nil
+}
+
+func (c *Config) validate() error {
+	if len(c.Allow) == 0 && len(c.Deny) == 0 && c.File == "" {
+		return errors.New("at least one of allow, deny or file is required")
+	}
+	if c.Status != 0 && (c.Status < 100 || c.Status > 599) {
+		return fmt.Errorf("invalid status `%d`", c.Status)
+	}
+	if c.WatchInterval < 0 {
+		return errors.New("watch_interval can not be negative")
+	}
+	return nil
+}
+
+func (c *Config) setDefaults() {
+	if c.Status == 0 {
+		c.Status = defaultStatus
+	}
+	if c.Body == "" {
+		c.Body = defaultBody
+	}
+	if c.ContentType == "" {
+		c.ContentType = defaultContentType
+	}
+	if c.WatchInterval == 0 {
+		c.WatchInterval = defaultWatchInterval
+	}
+}
+
+// load parses the lists of the config and the file, and replaces the rules
+func (rs *restriction) load() error {
+	all := rs.inline
+	if rs.config.File != "" {
+		raw, err := ioutil.ReadFile(rs.config.File)
+		if err != nil {
+			return fmt.Errorf("could not read ip-restriction file `%s` [%s]", rs.config.File, err)
+		}
+		var fromFile lists
+		if err := json.Unmarshal(raw, &fromFile); err != nil {
+			return fmt.Errorf("could not parse ip-restriction file `%s` [%s]", rs.config.File, err)
+		}
+		all.Allow = append(append([]string{}, all.Allow...), fromFile.Allow...)
+		all.Deny = append(append([]string{}, all.Deny...), fromFile.Deny...)
+	}
+
+	var r rules
+	var err error
+	if r.allow, err = parseCIDRs(all.Allow); err != nil {
+		return err
+	}
+	if r.deny, err = parseCIDRs(all.Deny); err != nil {
+		return err
+	}
+
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+	rs.rules = &r
+	return nil
+}
+
+func parseCIDRs(values []string) ([]*net.IPNet, error) {
+	cidrs := make([]*net.IPNet, 0, len(values))
+	for _, v := range values {
+		cidr, err := realip.ParseCIDR(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid IP or CIDR `%s` [%s]", v, err)
+		}
+		cidrs = append(cidrs, cidr)
+	}
+	return cidrs, nil
+}
+
+// allowed reports if the IP is allowed by the rules
+func (r *rules) allowed(ip net.IP) bool {
+	if contains(r.deny, ip) {
+		return false
+	}
+	return len(r.allow) == 0 || contains(r.allow, ip)
+}
+
+func contains(cidrs []*net.IPNet, ip net.IP) bool {
+	for _, cidr := range cidrs {
+		if cidr.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+func (rs *restriction) handler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rs.mu.RLock()
+		rules := rs.rules
+		rs.mu.RUnlock()
+
+		// requests of which client IP can not be resolved are denied
+		clientIP := realip.ClientIP(r)
+		if ip := net.ParseIP(clientIP); ip == nil || !rules.allowed(ip) {
+			logger.FromCtx(r.Context()).Debug("ip-restriction: request denied", "ip", clientIP)
+			w.Header().Set("Content-Type", rs.config.ContentType)
+			w.WriteHeader(rs.config.Status)
+			w.Write([]byte(rs.config.Body))
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
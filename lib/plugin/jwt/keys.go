@@ -0,0 +1,196 @@
+package jwt
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+)
+
+// key is a key tokens are verified with
+type key struct {
+	id  string // kid, blank for statically configured keys
+	alg string
+	key interface{}
+}
+
+func (k *key) matches(alg, kid string) bool {
+	if k.alg != alg {
+		return false
+	}
+	return kid == "" || k.id == "" || k.id == kid
+}
+
+func loadKeys(conf *Config) ([]*key, error) {
+	var keys []*key
+
+	if conf.Secret != "" {
+		keys = append(keys, &key{alg: HS256, key: []byte(conf.Secret)})
+	}
+
+	publicKey := []byte(conf.PublicKey)
+	if conf.PublicKeyFile != "" {
+		raw, err := ioutil.ReadFile(conf.PublicKeyFile)
+		if err != nil {
+			return nil, err
+		}
+		publicKey = raw
+	}
+	if len(publicKey) > 0 {
+		k, err := parsePublicKey(publicKey)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, k)
+	}
+
+	if conf.JWKSFile != "" {
+		jwks, err := loadJWKS(conf.JWKSFile)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, jwks...)
+	}
+
+	if len(keys) == 0 {
+		return nil, errors.New("one of secret, public_key, public_key_file or jwks_file is required")
+	}
+	return keys, nil
+}
+
+func parsePublicKey(raw []byte) (*key, error) {
+	block, _ := pem.Decode(raw)
+	if block == nil {
+		return nil, errors.New("public key is not PEM encoded")
+	}
+
+	var pub interface{}
+	var err error
+	switch block.Type {
+	case "CERTIFICATE":
+		var cert *x509.Certificate
+		if cert, err = x509.ParseCertificate(block.Bytes); err == nil {
+			pub = cert.PublicKey
+		}
+	case "RSA PUBLIC KEY":
+		pub, err = x509.ParsePKCS1PublicKey(block.Bytes)
+	default:
+		pub, err = x509.ParsePKIXPublicKey(block.Bytes)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("could not parse public key [%s]", err)
+	}
+
+	switch k := pub.(type) {
+	case *rsa.PublicKey:
+		return &key{alg: RS256, key: k}, nil
+	case *ecdsa.PublicKey:
+		if k.Curve != elliptic.P256() {
+			return nil, errors.New("only P-256 curve is supported for ES256")
+		}
+		return &key{alg: ES256, key: k}, nil
+	}
+	return nil, fmt.Errorf("unsupported public key type %T", pub)
+}
+
+// jwk is a JSON Web Key as defined in RFC 7517
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Alg string `json:"alg"`
+	Use string `json:"use"`
+	// RSA
+	N string `json:"n"`
+	E string `json:"e"`
+	// EC
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+	// symmetric
+	K string `json:"k"`
+}
+
+func loadJWKS(filePath string) ([]*key, error) {
+	raw, err := ioutil.ReadFile(filePath)
+	if err != nil {
+		return nil, err
+	}
+
+	var jwks struct {
+		Keys []jwk `json:"keys"`
+	}
+	if err := json.Unmarshal(raw, &jwks); err != nil {
+		return nil, fmt.Errorf("could not parse JWKS file %s [%s]", filePath, err)
+	}
+
+	keys := make([]*key, 0, len(jwks.Keys))
+	for _, j := range jwks.Keys {
+		if j.Use != "" && j.Use != "sig" {
+			continue
+		}
+		k, err := j.key()
+		if err != nil {
+			return nil, fmt.Errorf("JWKS key `%s`: %s", j.Kid, err)
+		}
+		if k == nil {
+			continue // key type is not supported
+		}
+		keys = append(keys, k)
+	}
+	return keys, nil
+}
+
+func (j *jwk) key() (*key, error) {
+	switch j.Kty {
+	case "RSA":
+		n, err := decodeBigInt(j.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decodeBigInt(j.E)
+		if err != nil {
+			return nil, err
+		}
+		return &key{id: j.Kid, alg: RS256, key: &rsa.PublicKey{N: n, E: int(e.Int64())}}, nil
+
+	case "EC":
+		if j.Crv != "P-256" {
+			return nil, nil
+		}
+		x, err := decodeBigInt(j.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := decodeBigInt(j.Y)
+		if err != nil {
+			return nil, err
+		}
+		return &key{id: j.Kid, alg: ES256, key: &ecdsa.PublicKey{Curve: elliptic.P256(), X: x, Y: y}}, nil
+
+	case "oct":
+		secret, err := base64.RawURLEncoding.DecodeString(j.K)
+		if err != nil {
+			return nil, err
+		}
+		if len(secret) == 0 {
+			return nil, errors.New("symmetric key must not be empty")
+		}
+		return &key{id: j.Kid, alg: HS256, key: secret}, nil
+	}
+	return nil, nil
+}
+
+func decodeBigInt(s string) (*big.Int, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, err
+	}
+	return new(big.Int).SetBytes(raw), nil
+}
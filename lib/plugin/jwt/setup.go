@@ -0,0 +1,144 @@
+package jwt
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/AyushSenapati/guardian/lib/logger"
+	"github.com/AyushSenapati/guardian/lib/middleware"
+	"github.com/AyushSenapati/guardian/lib/plugin/pluginconf"
+	"github.com/AyushSenapati/guardian/lib/proxy"
+)
+
+// Config defines jwt plugin config
+type Config struct {
+	// Algorithms accepted. Defaults to the algorithms of the configured keys
+	Algorithms []string `json:"algorithms"`
+
+	// keys the tokens are verified with
+	Secret        string `json:"secret"`
+	PublicKey     string `json:"public_key"`
+	PublicKeyFile string `json:"public_key_file"`
+	JWKSFile      string `json:"jwks_file"`
+
+	Issuer   string   `json:"issuer"`
+	Audience []string `json:"audience"`
+	// RequiredClaims maps claim names to their expected values.
+	// A null value only requires the claim to be present
+	RequiredClaims map[string]interface{} `json:"required_claims"`
+	// ForwardClaims maps claim names to the headers
+	// they are forwarded to the upstream in
+	ForwardClaims map[string]string `json:"forward_claims"`
+	// Leeway in second(s) to account for clock skew while validating exp and nbf
+	Leeway int `json:"leeway"`
+}
+
+// SetupJWT implements the logic to read the provided raw config and configure itself
+func SetupJWT(def *proxy.RouterDefinition, rawConfig map[string]interface{}) error {
+	var config Config
+	if err := pluginconf.Decode(rawConfig, &config); err != nil {
+		return err
+	}
+
+	v, err := newVerifier(&config)
+	if err != nil {
+		return err
+	}
+
+	def.AddMiddleware(authenticate(v, config.ForwardClaims))
+	return nil
+}
+
+func newVerifier(config *Config) (*verifier, error) {
+	keys, err := loadKeys(config)
+	if err != nil {
+		return nil, err
+	}
+
+	algorithms := make(map[string]bool)
+	for _, alg := range config.Algorithms {
+		switch alg {
+		case HS256, RS256, ES256:
+			algorithms[alg] = true
+		default:
+			return nil, fmt.Errorf("unsupported algorithm `%s`, should be of (HS256/RS256/ES256)", alg)
+		}
+	}
+	if len(algorithms) == 0 {
+		for _, k := range keys {
+			algorithms[k.alg] = true
+		}
+	}
+
+	return &verifier{
+		keys:           keys,
+		algorithms:     algorithms,
+		issuer:         config.Issuer,
+		audience:       config.Audience,
+		requiredClaims: config.RequiredClaims,
+		leeway:         time.Duration(config.Leeway) * time.Second,
+		now:            time.Now,
+	}, nil
+}
+
+func authenticate(v *verifier, forwardClaims map[string]string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			token := bearerToken(r)
+			if token == "" {
+				unauthorized(w, "")
+				return
+			}
+
+			claims, err := v.verify(token)
+			if err != nil {
+				logger.FromCtx(r.Context()).Debug("jwt: token rejected", "error", err)
+				unauthorized(w, `error="invalid_token"`)
+				return
+			}
+
+			// headers carrying claims are always set by the gateway,
+			// so that clients can not spoof them
+			for claim, headerName := range forwardClaims {
+				r.Header.Del(headerName)
+				if value, found := claims[claim]; found {
+					r.Header.Set(headerName, claimString(value))
+				}
+			}
+
+			next.ServeHTTP(w, r.WithContext(middleware.WithClaims(r.Context(), claims)))
+		})
+	}
+}
+
+func bearerToken(r *http.Request) string {
+	auth := r.Header.Get("Authorization")
+	if len(auth) > 7 && strings.EqualFold(auth[:7], "Bearer ") {
+		return strings.TrimSpace(auth[7:])
+	}
+	return ""
+}
+
+func unauthorized(w http.ResponseWriter, params string) {
+	challenge := "Bearer"
+	if params != "" {
+		challenge += " " + params
+	}
+	w.Header().Set("WWW-Authenticate", challenge)
+	http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+}
+
+// claimString returns the claim value as header value.
+// Arrays are joined by comma
+func claimString(value interface{}) string {
+	if values, ok := value.([]interface{}); ok {
+		parts := make([]string, 0, len(values))
+		for _, v := range values {
+			parts = append(parts, fmt.Sprint(v))
+		}
+		return strings.Join(parts, ",")
+	}
+	return fmt.Sprint(value)
+}
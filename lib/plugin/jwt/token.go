@@ -0,0 +1,241 @@
+package jwt
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/hmac"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+	"time"
+)
+
+// supported signing algorithms
+const (
+	HS256 = "HS256"
+	RS256 = "RS256"
+	ES256 = "ES256"
+)
+
+var (
+	errMalformed    = errors.New("malformed token")
+	errSignature    = errors.New("invalid signature")
+	errUnknownKey   = errors.New("no key to verify the token")
+	errExpired      = errors.New("token is expired")
+	errNotValidYet  = errors.New("token is not valid yet")
+	errBadIssuer    = errors.New("token issuer is not accepted")
+	errBadAudience  = errors.New("token audience is not accepted")
+	errMissingClaim = errors.New("required claim is missing or invalid")
+	errNumericDate  = errors.New("claim is not a numeric date")
+)
+
+// Claims are the claims of a verified token
+type Claims map[string]interface{}
+
+type header struct {
+	Alg string `json:"alg"`
+	Kid string `json:"kid"`
+}
+
+// verifier verifies tokens and validates their claims
+type verifier struct {
+	keys           []*key
+	algorithms     map[string]bool
+	issuer         string
+	audience       []string
+	requiredClaims map[string]interface{}
+	leeway         time.Duration
+	now            func() time.Time
+}
+
+func (v *verifier) verify(token string) (Claims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, errMalformed
+	}
+
+	var hdr header
+	if err := decodeSegment(parts[0], &hdr); err != nil {
+		return nil, errMalformed
+	}
+	if !v.algorithms[hdr.Alg] {
+		return nil, fmt.Errorf("algorithm `%s` is not accepted", hdr.Alg)
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, errMalformed
+	}
+
+	if err := v.verifySignature(hdr, parts[0]+"."+parts[1], signature); err != nil {
+		return nil, err
+	}
+
+	var claims Claims
+	if err := decodeSegment(parts[1], &claims); err != nil {
+		return nil, errMalformed
+	}
+	if err := v.validate(claims); err != nil {
+		return nil, err
+	}
+	return claims, nil
+}
+
+func (v *verifier) verifySignature(hdr header, signingInput string, signature []byte) error {
+	digest := sha256.Sum256([]byte(signingInput))
+
+	found := false
+	for _, k := range v.keys {
+		if !k.matches(hdr.Alg, hdr.Kid) {
+			continue
+		}
+		found = true
+
+		switch pub := k.key.(type) {
+		case []byte:
+			mac := hmac.New(sha256.New, pub)
+			mac.Write([]byte(signingInput))
+			if hmac.Equal(mac.Sum(nil), signature) {
+				return nil
+			}
+		case *rsa.PublicKey:
+			if rsa.VerifyPKCS1v15(pub, crypto.SHA256, digest[:], signature) == nil {
+				return nil
+			}
+		case *ecdsa.PublicKey:
+			// ES256 signature is R and S concatenated, 32 bytes each
+			if len(signature) == 64 {
+				r := new(big.Int).SetBytes(signature[:32])
+				s := new(big.Int).SetBytes(signature[32:])
+				if ecdsa.Verify(pub, digest[:], r, s) {
+					return nil
+				}
+			}
+		}
+	}
+
+	if !found {
+		return errUnknownKey
+	}
+	return errSignature
+}
+
+func (v *verifier) validate(claims Claims) error {
+	now := v.now()
+
+	exp, ok, err := numericClaim(claims, "exp")
+	if err != nil {
+		return err
+	}
+	if ok && !now.Before(exp.Add(v.leeway)) {
+		return errExpired
+	}
+	nbf, ok, err := numericClaim(claims, "nbf")
+	if err != nil {
+		return err
+	}
+	if ok && now.Add(v.leeway).Before(nbf) {
+		return errNotValidYet
+	}
+
+	if v.issuer != "" {
+		if iss, _ := claims["iss"].(string); iss != v.issuer {
+			return errBadIssuer
+		}
+	}
+
+	if len(v.audience) > 0 && !containsAny(audience(claims), v.audience) {
+		return errBadAudience
+	}
+
+	for name, expected := range v.requiredClaims {
+		value, found := claims[name]
+		if !found {
+			return fmt.Errorf("%w: %s", errMissingClaim, name)
+		}
+		if expected != nil && !claimMatches(value, expected) {
+			return fmt.Errorf("%w: %s", errMissingClaim, name)
+		}
+	}
+
+	return nil
+}
+
+// numericClaim returns the NumericDate claim as time and reports if it is
+// present. Claim which is present but not a number fails the validation,
+// otherwise a token having a malformed exp would never expire
+func numericClaim(claims Claims, name string) (time.Time, bool, error) {
+	value, found := claims[name]
+	if !found {
+		return time.Time{}, false, nil
+	}
+	n, ok := value.(json.Number)
+	if !ok {
+		return time.Time{}, false, fmt.Errorf("%w: %s", errNumericDate, name)
+	}
+	secs, err := n.Float64()
+	if err != nil {
+		return time.Time{}, false, fmt.Errorf("%w: %s", errNumericDate, name)
+	}
+	return time.Unix(0, int64(secs*float64(time.Second))), true, nil
+}
+
+// audience returns the aud claim, which can either be a string or an array
+func audience(claims Claims) []string {
+	switch aud := claims["aud"].(type) {
+	case string:
+		return []string{aud}
+	case []interface{}:
+		auds := make([]string, 0, len(aud))
+		for _, a := range aud {
+			if s, ok := a.(string); ok {
+				auds = append(auds, s)
+			}
+		}
+		return auds
+	}
+	return nil
+}
+
+func containsAny(values, accepted []string) bool {
+	for _, v := range values {
+		for _, a := range accepted {
+			if v == a {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// claimMatches checks claim value against expected value. If the claim is
+// an array, it matches if any of its elements is equal to the expected value
+func claimMatches(value, expected interface{}) bool {
+	want := fmt.Sprint(expected)
+	if values, ok := value.([]interface{}); ok {
+		for _, v := range values {
+			if fmt.Sprint(v) == want {
+				return true
+			}
+		}
+		return false
+	}
+	return fmt.Sprint(value) == want
+}
+
+func decodeSegment(segment string, v interface{}) error {
+	raw, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return err
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(raw))
+	decoder.UseNumber()
+	return decoder.Decode(v)
+}
@@ -0,0 +1,234 @@
+package jwt
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+var testNow = time.Unix(1600000000, 0)
+
+// sign returns a token of the header and claims signed with the key
+func sign(t *testing.T, hdr header, claims map[string]interface{}, signer interface{}) string {
+	t.Helper()
+	encode := func(v interface{}) string {
+		b, err := json.Marshal(v)
+		if err != nil {
+			t.Fatalf("could not marshal: %s", err)
+		}
+		return base64.RawURLEncoding.EncodeToString(b)
+	}
+	signingInput := encode(hdr) + "." + encode(claims)
+	digest := sha256.Sum256([]byte(signingInput))
+
+	var signature []byte
+	switch k := signer.(type) {
+	case []byte:
+		mac := hmac.New(sha256.New, k)
+		mac.Write([]byte(signingInput))
+		signature = mac.Sum(nil)
+	case *rsa.PrivateKey:
+		var err error
+		if signature, err = rsa.SignPKCS1v15(rand.Reader, k, crypto.SHA256, digest[:]); err != nil {
+			t.Fatalf("could not sign: %s", err)
+		}
+	case *ecdsa.PrivateKey:
+		r, s, err := ecdsa.Sign(rand.Reader, k, digest[:])
+		if err != nil {
+			t.Fatalf("could not sign: %s", err)
+		}
+		signature = make([]byte, 64)
+		r.FillBytes(signature[:32])
+		s.FillBytes(signature[32:])
+	}
+	return signingInput + "." + base64.RawURLEncoding.EncodeToString(signature)
+}
+
+func newTestVerifier(keys ...*key) *verifier {
+	v := &verifier{keys: keys, algorithms: map[string]bool{}, now: func() time.Time { return testNow }}
+	for _, k := range keys {
+		v.algorithms[k.alg] = true
+	}
+	return v
+}
+
+func TestVerifySignature(t *testing.T) {
+	secret := []byte("secret")
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("could not generate RSA key: %s", err)
+	}
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("could not generate EC key: %s", err)
+	}
+
+	v := newTestVerifier(
+		&key{alg: HS256, key: secret},
+		&key{id: "rsa", alg: RS256, key: &rsaKey.PublicKey},
+		&key{id: "ec", alg: ES256, key: &ecKey.PublicKey},
+	)
+	claims := map[string]interface{}{"sub": "user"}
+
+	// claims of a token signed by the key, having the signature of another token
+	signed := strings.Split(sign(t, header{Alg: HS256}, claims, secret), ".")
+	other := strings.Split(sign(t, header{Alg: HS256}, map[string]interface{}{"sub": "admin"}, secret), ".")
+	tampered := signed[0] + "." + other[1] + "." + signed[2]
+
+	tests := []struct {
+		name    string
+		token   string
+		wantErr error
+	}{
+		{name: "HS256", token: sign(t, header{Alg: HS256}, claims, secret)},
+		{name: "RS256", token: sign(t, header{Alg: RS256, Kid: "rsa"}, claims, rsaKey)},
+		{name: "ES256", token: sign(t, header{Alg: ES256, Kid: "ec"}, claims, ecKey)},
+		{
+			name:    "wrong secret",
+			token:   sign(t, header{Alg: HS256}, claims, []byte("other")),
+			wantErr: errSignature,
+		},
+		{
+			name:    "unknown kid",
+			token:   sign(t, header{Alg: RS256, Kid: "other"}, claims, rsaKey),
+			wantErr: errUnknownKey,
+		},
+		{
+			name:    "tampered claims",
+			token:   tampered,
+			wantErr: errSignature,
+		},
+		{name: "malformed", token: "a.b", wantErr: errMalformed},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := v.verify(tt.token)
+			if tt.wantErr == nil && err != nil {
+				t.Fatalf("got error %s, want none", err)
+			}
+			if tt.wantErr != nil && !errors.Is(err, tt.wantErr) {
+				t.Fatalf("got error %v, want %s", err, tt.wantErr)
+			}
+		})
+	}
+
+	t.Run("algorithm not accepted", func(t *testing.T) {
+		token := sign(t, header{Alg: "none"}, claims, secret)
+		if _, err := v.verify(token); err == nil {
+			t.Fatal("token of not accepted algorithm is verified")
+		}
+	})
+}
+
+func TestValidateClaims(t *testing.T) {
+	now := testNow.Unix()
+
+	tests := []struct {
+		name    string
+		v       func(v *verifier)
+		claims  map[string]interface{}
+		wantErr error
+	}{
+		{name: "no time claims", claims: map[string]interface{}{}},
+		{name: "not expired", claims: map[string]interface{}{"exp": now + 60}},
+		{name: "expired", claims: map[string]interface{}{"exp": now - 60}, wantErr: errExpired},
+		{name: "expires now", claims: map[string]interface{}{"exp": now}, wantErr: errExpired},
+		{
+			name:   "expired within leeway",
+			v:      func(v *verifier) { v.leeway = time.Minute },
+			claims: map[string]interface{}{"exp": now - 30},
+		},
+		{name: "valid since", claims: map[string]interface{}{"nbf": now - 60}},
+		{name: "not valid yet", claims: map[string]interface{}{"nbf": now + 60}, wantErr: errNotValidYet},
+		{name: "exp is a string", claims: map[string]interface{}{"exp": "9999999999"}, wantErr: errNumericDate},
+		{name: "nbf is a string", claims: map[string]interface{}{"nbf": "0"}, wantErr: errNumericDate},
+		{
+			name:   "issuer",
+			v:      func(v *verifier) { v.issuer = "auth" },
+			claims: map[string]interface{}{"iss": "auth"},
+		},
+		{
+			name:    "other issuer",
+			v:       func(v *verifier) { v.issuer = "auth" },
+			claims:  map[string]interface{}{"iss": "other"},
+			wantErr: errBadIssuer,
+		},
+		{
+			name:   "audience string",
+			v:      func(v *verifier) { v.audience = []string{"api"} },
+			claims: map[string]interface{}{"aud": "api"},
+		},
+		{
+			name:   "audience array",
+			v:      func(v *verifier) { v.audience = []string{"api"} },
+			claims: map[string]interface{}{"aud": []string{"web", "api"}},
+		},
+		{
+			name:    "other audience",
+			v:       func(v *verifier) { v.audience = []string{"api"} },
+			claims:  map[string]interface{}{"aud": "web"},
+			wantErr: errBadAudience,
+		},
+		{
+			name:   "required claim present",
+			v:      func(v *verifier) { v.requiredClaims = map[string]interface{}{"sub": nil} },
+			claims: map[string]interface{}{"sub": "user"},
+		},
+		{
+			name:    "required claim missing",
+			v:       func(v *verifier) { v.requiredClaims = map[string]interface{}{"sub": nil} },
+			claims:  map[string]interface{}{},
+			wantErr: errMissingClaim,
+		},
+		{
+			name:   "required claim in array",
+			v:      func(v *verifier) { v.requiredClaims = map[string]interface{}{"roles": "admin"} },
+			claims: map[string]interface{}{"roles": []string{"user", "admin"}},
+		},
+		{
+			name:    "required claim of other value",
+			v:       func(v *verifier) { v.requiredClaims = map[string]interface{}{"roles": "admin"} },
+			claims:  map[string]interface{}{"roles": "user"},
+			wantErr: errMissingClaim,
+		},
+	}
+
+	secret := []byte("secret")
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v := newTestVerifier(&key{alg: HS256, key: secret})
+			if tt.v != nil {
+				tt.v(v)
+			}
+
+			_, err := v.verify(sign(t, header{Alg: HS256}, tt.claims, secret))
+			if tt.wantErr == nil && err != nil {
+				t.Fatalf("got error %s, want none", err)
+			}
+			if tt.wantErr != nil && !errors.Is(err, tt.wantErr) {
+				t.Fatalf("got error %v, want %s", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestJWKRejectsEmptySymmetricKey(t *testing.T) {
+	if _, err := (&jwk{Kty: "oct", Kid: "empty"}).key(); err == nil {
+		t.Fatal("symmetric key without k is accepted")
+	}
+	k, err := (&jwk{Kty: "oct", K: base64.RawURLEncoding.EncodeToString([]byte("secret"))}).key()
+	if err != nil || k == nil {
+		t.Fatalf("got key %v, error %v, want a key", k, err)
+	}
+}
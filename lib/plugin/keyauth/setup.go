@@ -0,0 +1,143 @@
+package keyauth
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/AyushSenapati/guardian/lib/consumer"
+	"github.com/AyushSenapati/guardian/lib/logger"
+	"github.com/AyushSenapati/guardian/lib/plugin/pluginconf"
+	"github.com/AyushSenapati/guardian/lib/proxy"
+)
+
+// places the key can be looked for
+const (
+	inHeader = "header"
+	inQuery  = "query"
+	inCookie = "cookie"
+)
+
+// consumerHeader carries the name of the authenticated consumer to the upstream
+const consumerHeader = "X-Consumer-Name"
+
+// Config defines key-auth plugin config
+type Config struct {
+	// KeyNames are the names of the header, query param or cookie
+	// carrying the key. Defaults to apikey
+	KeyNames []string `json:"key_names"`
+	// KeyIn lists where the key is looked for in order.
+	// Each of them is header, query or cookie. Defaults to header and query
+	KeyIn []string `json:"key_in"`
+	// HideCredentials removes the key from the request proxied to the upstream
+	HideCredentials bool `json:"hide_credentials"`
+}
+
+// SetupKeyAuth implements the logic to read the provided raw config and configure itself
+func SetupKeyAuth(def *proxy.RouterDefinition, rawConfig map[string]interface{}) error {
+	var config Config
+	if err := pluginconf.Decode(rawConfig, &config); err != nil {
+		return err
+	}
+
+	if len(config.KeyNames) == 0 {
+		config.KeyNames = []string{"apikey"}
+	}
+	if len(config.KeyIn) == 0 {
+		config.KeyIn = []string{inHeader, inQuery}
+	}
+	for _, in := range config.KeyIn {
+		switch in {
+		case inHeader, inQuery, inCookie:
+		default:
+			return fmt.Errorf("unsupported key_in `%s`, should be of (header/query/cookie)", in)
+		}
+	}
+
+	def.AddMiddleware(authenticate(config))
+	return nil
+}
+
+func authenticate(config Config) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			key := findKey(r, config)
+			if key == "" {
+				http.Error(w, "No API key found in request", http.StatusUnauthorized)
+				return
+			}
+
+			c, found := consumer.Lookup(key)
+			if !found {
+				logger.FromCtx(r.Context()).Debug("key-auth: invalid key")
+				http.Error(w, "Invalid authentication credentials", http.StatusUnauthorized)
+				return
+			}
+
+			if config.HideCredentials {
+				hideKey(r, config)
+			}
+			r.Header.Set(consumerHeader, c.Name)
+
+			next.ServeHTTP(w, r.WithContext(consumer.WithConsumer(r.Context(), c)))
+		})
+	}
+}
+
+func findKey(r *http.Request, config Config) string {
+	for _, in := range config.KeyIn {
+		for _, name := range config.KeyNames {
+			var key string
+			switch in {
+			case inHeader:
+				key = r.Header.Get(name)
+			case inQuery:
+				key = r.URL.Query().Get(name)
+			case inCookie:
+				if c, err := r.Cookie(name); err == nil {
+					key = c.Value
+				}
+			}
+			if key != "" {
+				return key
+			}
+		}
+	}
+	return ""
+}
+
+func hideKey(r *http.Request, config Config) {
+	for _, in := range config.KeyIn {
+		switch in {
+		case inHeader:
+			for _, name := range config.KeyNames {
+				r.Header.Del(name)
+			}
+
+		case inQuery:
+			query := r.URL.Query()
+			for _, name := range config.KeyNames {
+				query.Del(name)
+			}
+			r.URL.RawQuery = query.Encode()
+
+		case inCookie:
+			// cookies are rebuilt without the ones carrying the key
+			cookies := r.Cookies()
+			r.Header.Del("Cookie")
+			for _, c := range cookies {
+				if !contains(config.KeyNames, c.Name) {
+					r.AddCookie(c)
+				}
+			}
+		}
+	}
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,188 @@
+package limiter
+
+import (
+	"fmt"
+	"math"
+	"time"
+)
+
+// supported algorithms
+const (
+	TokenBucket   = "token-bucket"
+	LeakyBucket   = "leaky-bucket"
+	FixedWindow   = "fixed-window"
+	SlidingWindow = "sliding-window"
+)
+
+// state is the limiter state of a key for a rate. Meaning of
+// the fields depends on the algorithm which maintains it
+type state struct {
+	// Count is the tokens left in token bucket, or
+	// requests counted in the current window
+	Count float64
+	// Prev is the requests counted in the previous window
+	Prev float64
+	// At is the last refill of token bucket, the time
+	// the bucket drains in leaky bucket, or start of the window.
+	// Zero means the key is seen for the first time
+	At int64
+	// Expires is when the state is as good as a fresh one
+	Expires int64
+}
+
+// Result is the outcome of a request taken by the limiter
+type Result struct {
+	Allowed   bool
+	Limit     int64
+	Remaining int64
+	// Reset is the time after which the quota is fully available again
+	Reset time.Duration
+	// RetryAfter is the time after which rejected request can be retried
+	RetryAfter time.Duration
+	// Delay is the time allowed request must wait before it is served,
+	// so that the requests are served at constant rate (leaky bucket)
+	Delay time.Duration
+}
+
+// algorithm takes a request of the key at now. It returns the new state and
+// the result, leaving the given state unchanged, so that the request can be
+// checked against all the rates before it is counted against any of them
+type algorithm func(s state, r Rate, now int64) (state, Result)
+
+var algorithms = map[string]algorithm{
+	TokenBucket:   tokenBucket,
+	LeakyBucket:   leakyBucket,
+	FixedWindow:   fixedWindow,
+	SlidingWindow: slidingWindow,
+}
+
+func getAlgorithm(name string) (algorithm, error) {
+	alg, found := algorithms[name]
+	if !found {
+		return nil, fmt.Errorf(
+			"unsupported strategy `%s`, should be of (%s/%s/%s/%s)",
+			name, TokenBucket, LeakyBucket, FixedWindow, SlidingWindow,
+		)
+	}
+	return alg, nil
+}
+
+// tokenBucket lets bursts of up to limit requests through.
+// Tokens are refilled at limit per period
+func tokenBucket(s state, r Rate, now int64) (state, Result) {
+	period, limit := float64(r.Period), float64(r.Limit)
+	if s.At == 0 {
+		s.Count = limit
+	} else if elapsed := now - s.At; elapsed > 0 {
+		s.Count = math.Min(limit, s.Count+float64(elapsed)*limit/period)
+	}
+	s.At = now
+
+	res := Result{Limit: r.Limit}
+	if s.Count >= 1 {
+		s.Count--
+		res.Allowed = true
+	} else {
+		res.RetryAfter = time.Duration((1 - s.Count) * period / limit)
+	}
+	res.Remaining = int64(s.Count)
+	res.Reset = time.Duration((limit - s.Count) * period / limit)
+	s.Expires = now + int64(res.Reset)
+	return s, res
+}
+
+// leakyBucket serves the requests at constant rate of one per period/limit.
+// Up to limit requests are queued, and delayed till their turn. Requests
+// are not queued for longer than the max delay of the rate, if it has one
+func leakyBucket(s state, r Rate, now int64) (state, Result) {
+	interval := int64(r.Period) / r.Limit
+	queue := int64(r.Period) - interval
+	if r.maxDelay > 0 && int64(r.maxDelay) < queue {
+		queue = int64(r.maxDelay)
+	}
+	next := s.At
+	if next < now {
+		next = now
+	}
+
+	res := Result{Limit: r.Limit}
+	if wait := next - now; wait <= queue {
+		s.At = next + interval
+		res.Allowed = true
+		res.Delay = time.Duration(wait)
+	} else {
+		res.RetryAfter = time.Duration(wait - queue)
+	}
+	res.Remaining = (queue + interval - (s.At - now)) / interval
+	if res.Remaining < 0 {
+		res.Remaining = 0
+	}
+	res.Reset = time.Duration(s.At - now)
+	if res.Reset < 0 {
+		res.Reset = 0
+	}
+	s.Expires = s.At
+	return s, res
+}
+
+// fixedWindow allows limit requests in each window of the period
+func fixedWindow(s state, r Rate, now int64) (state, Result) {
+	window := now - now%int64(r.Period)
+	if s.At != window {
+		s.Count, s.At = 0, window
+	}
+	end := window + int64(r.Period)
+
+	res := Result{Limit: r.Limit, Reset: time.Duration(end - now)}
+	if s.Count < float64(r.Limit) {
+		s.Count++
+		res.Allowed = true
+	} else {
+		res.RetryAfter = res.Reset
+	}
+	res.Remaining = r.Limit - int64(s.Count)
+	s.Expires = end
+	return s, res
+}
+
+// slidingWindow approximates the requests in the period preceding now, by
+// weighting the requests of the previous window by its overlap with the period
+func slidingWindow(s state, r Rate, now int64) (state, Result) {
+	period := int64(r.Period)
+	window := now - now%period
+	switch {
+	case s.At == window-period:
+		s.Prev, s.Count = s.Count, 0
+	case s.At != window:
+		s.Prev, s.Count = 0, 0
+	}
+	s.At = window
+
+	limit := float64(r.Limit)
+	elapsed := float64(now-window) / float64(period)
+	estimated := s.Prev*(1-elapsed) + s.Count
+
+	res := Result{Limit: r.Limit}
+	if estimated+1 <= limit {
+		s.Count++
+		estimated++
+		res.Allowed = true
+	} else if s.Count+1 > limit {
+		// the request is allowed once enough of the current
+		// window slides out, after the window moves on
+		overlap := (limit - 1) / s.Count
+		res.RetryAfter = time.Duration(float64(window+period-now) + float64(period)*(1-overlap))
+	} else {
+		// the request is allowed once enough of the previous window slides out
+		overlap := (limit - s.Count - 1) / s.Prev
+		res.RetryAfter = time.Duration(float64(period)*(1-overlap) - float64(now-window))
+	}
+	res.Remaining = int64(math.Max(0, limit-estimated))
+	if s.Count > 0 {
+		res.Reset = time.Duration(window + 2*period - now)
+	} else {
+		res.Reset = time.Duration(window + period - now)
+	}
+	s.Expires = window + 2*period
+	return s, res
+}
@@ -0,0 +1,177 @@
+package limiter
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/AyushSenapati/guardian/lib/consumer"
+	"github.com/AyushSenapati/guardian/lib/middleware"
+	"github.com/AyushSenapati/guardian/lib/realip"
+	"github.com/AyushSenapati/guardian/lib/router"
+)
+
+// supported policies. Policies having an argument
+// are written with it like header:X-Tenant-ID
+const (
+	PolicyIP       = "ip"
+	PolicyConsumer = "consumer"
+	PolicyAPIKey   = "api_key" // optional argument is the key name, defaults to apikey
+	PolicyHeader   = "header"
+	PolicyPath     = "path"
+	PolicyRoute    = "route"
+	PolicyClaim    = "claim"
+)
+
+const defaultAPIKeyName = "apikey"
+
+// keyPart resolves a part of the limiter key from the request.
+// It returns false if the request does not have the part
+type keyPart struct {
+	name    string
+	resolve func(r *http.Request) (string, bool)
+}
+
+// limiterKey composes the key the requests are limited by
+type limiterKey []keyPart
+
+// parsePolicy parses the policy, which can be composed of multiple
+// policies joined by + like consumer+header:X-Tenant-ID
+func parsePolicy(policy string) (limiterKey, error) {
+	if policy == "" {
+		policy = PolicyIP
+	}
+
+	var key limiterKey
+	for _, spec := range strings.Split(policy, "+") {
+		spec = strings.TrimSpace(spec)
+		name, arg := spec, ""
+		if i := strings.Index(spec, ":"); i >= 0 {
+			name, arg = spec[:i], spec[i+1:]
+		}
+		name = strings.ToLower(name)
+
+		part := keyPart{name: name}
+		switch name {
+		case PolicyIP:
+			part.resolve = resolveIP
+		case PolicyConsumer:
+			part.resolve = resolveConsumer
+		case PolicyAPIKey:
+			if arg == "" {
+				arg = defaultAPIKeyName
+			}
+			part.resolve = resolveAPIKey(arg)
+		case PolicyHeader:
+			if arg == "" {
+				return nil, fmt.Errorf("policy `%s` requires a header name like header:X-Tenant-ID", spec)
+			}
+			part.name += ":" + http.CanonicalHeaderKey(arg)
+			part.resolve = resolveHeader(arg)
+		case PolicyPath:
+			part.resolve = resolvePath
+		case PolicyRoute:
+			part.resolve = resolveRoute
+		case PolicyClaim:
+			if arg == "" {
+				return nil, fmt.Errorf("policy `%s` requires a claim name like claim:sub", spec)
+			}
+			part.name += ":" + arg
+			part.resolve = resolveClaim(arg)
+		default:
+			return nil, fmt.Errorf(
+				"unsupported policy `%s`, should be of (ip/consumer/api_key/header/path/route/claim)", spec)
+		}
+
+		if (name == PolicyIP || name == PolicyConsumer || name == PolicyPath || name == PolicyRoute) && arg != "" {
+			return nil, fmt.Errorf("policy `%s` does not take an argument", spec)
+		}
+		key = append(key, part)
+	}
+	return key, nil
+}
+
+// resolve returns the key of the request. If any of the parts can not be
+// resolved, like the consumer of an unauthenticated request, the request is
+// limited by its IP, so that it is not let through unlimited. It returns
+// empty key if the IP can not be resolved either
+func (k limiterKey) resolve(r *http.Request) string {
+	parts := make([]string, 0, len(k))
+	for _, part := range k {
+		value, ok := part.resolve(r)
+		if !ok {
+			if ip, ok := resolveIP(r); ok {
+				return PolicyIP + "=" + ip
+			}
+			return ""
+		}
+		parts = append(parts, part.name+"="+value)
+	}
+	return strings.Join(parts, "|")
+}
+
+func resolveIP(r *http.Request) (string, bool) {
+	ip := realip.ClientIP(r)
+	return ip, ip != ""
+}
+
+func resolveConsumer(r *http.Request) (string, bool) {
+	c, ok := consumer.FromCtx(r.Context())
+	if !ok {
+		return "", false
+	}
+	return c.Name, true
+}
+
+// resolveAPIKey returns the hash of the key found in the header or
+// query param, so that the keys are not kept in the limiter store
+func resolveAPIKey(name string) func(r *http.Request) (string, bool) {
+	return func(r *http.Request) (string, bool) {
+		key := r.Header.Get(name)
+		if key == "" {
+			key = r.URL.Query().Get(name)
+		}
+		if key == "" {
+			return "", false
+		}
+		sum := sha256.Sum256([]byte(key))
+		return hex.EncodeToString(sum[:16]), true
+	}
+}
+
+func resolveHeader(name string) func(r *http.Request) (string, bool) {
+	return func(r *http.Request) (string, bool) {
+		value := r.Header.Get(name)
+		return value, value != ""
+	}
+}
+
+func resolvePath(r *http.Request) (string, bool) {
+	return r.URL.Path, true
+}
+
+// resolveRoute returns the route pattern matched by the request, so that
+// all the requests matching the same route share the quota whatever their path
+func resolveRoute(r *http.Request) (string, bool) {
+	route := router.RouteFromCtx(r.Context())
+	if route.Service == "" {
+		return "", false
+	}
+	return route.Service + ":" + route.Path, true
+}
+
+func resolveClaim(name string) func(r *http.Request) (string, bool) {
+	return func(r *http.Request) (string, bool) {
+		claims, ok := middleware.ClaimsFromCtx(r.Context())
+		if !ok {
+			return "", false
+		}
+		value, found := claims[name]
+		if !found || value == nil {
+			return "", false
+		}
+		return fmt.Sprint(value), true
+	}
+}
@@ -0,0 +1,66 @@
+package limiter
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// units of the rate period
+var periodUnits = map[string]time.Duration{
+	"S": time.Second,
+	"M": time.Minute,
+	"H": time.Hour,
+	"D": 24 * time.Hour,
+}
+
+// Rate allows Limit requests per Period
+type Rate struct {
+	Limit  int64
+	Period time.Duration
+	spec   string
+
+	// maxDelay is the longest a request is queued by leaky bucket
+	maxDelay time.Duration
+}
+
+// ParseRate parses the rate of format <limit>/<count>-<unit> like 5/1-M,
+// which allows 5 requests per minute. Count can be omitted like 5/M.
+// Supported units are S, M, H and D
+func ParseRate(spec string) (Rate, error) {
+	parts := strings.SplitN(spec, "/", 2)
+	if len(parts) != 2 {
+		return Rate{}, fmt.Errorf("invalid rate `%s`, should be of format <limit>/<count>-<unit>", spec)
+	}
+
+	limit, err := strconv.ParseInt(strings.TrimSpace(parts[0]), 10, 64)
+	if err != nil || limit <= 0 {
+		return Rate{}, fmt.Errorf("invalid rate `%s`, limit should be a positive integer", spec)
+	}
+
+	count, unit := int64(1), strings.TrimSpace(parts[1])
+	if i := strings.Index(unit, "-"); i >= 0 {
+		count, err = strconv.ParseInt(unit[:i], 10, 64)
+		if err != nil || count <= 0 {
+			return Rate{}, fmt.Errorf("invalid rate `%s`, period count should be a positive integer", spec)
+		}
+		unit = unit[i+1:]
+	}
+
+	d, found := periodUnits[strings.ToUpper(unit)]
+	if !found {
+		return Rate{}, fmt.Errorf("invalid rate `%s`, period unit should be of (S/M/H/D)", spec)
+	}
+	// requests are timed in microseconds by the redis storage,
+	// so a rate can not allow more than one request per microsecond
+	period := time.Duration(count) * d
+	if period/time.Microsecond/time.Duration(limit) == 0 {
+		return Rate{}, fmt.Errorf("invalid rate `%s`, limit is too high for the period", spec)
+	}
+	return Rate{Limit: limit, Period: period, spec: spec}, nil
+}
+
+func (r Rate) String() string {
+	return r.spec
+}
@@ -0,0 +1,303 @@
+package limiter
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/AyushSenapati/guardian/lib/logger"
+)
+
+// defaults of redis storage config
+const (
+	defaultRedisAddress = "localhost:6379"
+	defaultRedisTimeout = 100 // in millisecond(s)
+	defaultRedisMaxIdle = 16
+	defaultRedisPrefix  = "guardian:limiter:"
+	// redisRetryInterval is the time limiter keeps limiting locally
+	// after the redis server is found unreachable, before trying it again
+	redisRetryInterval = 5 * time.Second
+)
+
+// RedisConfig defines how to reach the redis server
+type RedisConfig struct {
+	// Address defaults to localhost:6379
+	Address  string `json:"address"`
+	Password string `json:"password"`
+	DB       int    `json:"db"`
+	// Timeout of the redis commands, in millisecond(s). Defaults to 100
+	Timeout int `json:"timeout"`
+	// MaxIdle connections kept in the pool. Defaults to 16
+	MaxIdle int `json:"max_idle"`
+	// Prefix of the keys. Defaults to guardian:limiter:
+	Prefix string `json:"prefix"`
+}
+
+// takeScript applies the algorithm to the state of all the rates atomically.
+// It mirrors the algorithms of the local store, with the times in microseconds.
+// KEYS are the keys of the rates, ARGV are now, the algorithm, and limit,
+// period and max delay of each rate. It returns allowed, limit, remaining, reset, retry after
+// and delay of each rate. The states are updated only if all the rates allow it
+const takeScript = `
+local now = tonumber(ARGV[1])
+local alg = ARGV[2]
+local allowed = 1
+local states, results = {}, {}
+
+for i, key in ipairs(KEYS) do
+	local limit = tonumber(ARGV[3 * i])
+	local period = tonumber(ARGV[1 + 3 * i])
+	local maxDelay = tonumber(ARGV[2 + 3 * i])
+	local v = redis.call('HMGET', key, 'c', 'p', 'a')
+	local c, p, a = tonumber(v[1]) or 0, tonumber(v[2]) or 0, tonumber(v[3]) or 0
+	local ok, remaining, reset, retry, delay, expires = 0, 0, 0, 0, 0, 0
+
+	if alg == 'token-bucket' then
+		if a == 0 then
+			c = limit
+		elseif now > a then
+			c = math.min(limit, c + (now - a) * limit / period)
+		end
+		a = now
+		if c >= 1 then
+			c = c - 1
+			ok = 1
+		else
+			retry = (1 - c) * period / limit
+		end
+		remaining = math.floor(c)
+		reset = (limit - c) * period / limit
+		expires = now + reset
+
+	elseif alg == 'leaky-bucket' then
+		local interval = math.floor(period / limit)
+		local queue = period - interval
+		if maxDelay > 0 and maxDelay < queue then
+			queue = maxDelay
+		end
+		local nxt = math.max(a, now)
+		local wait = nxt - now
+		if wait <= queue then
+			a = nxt + interval
+			ok = 1
+			delay = wait
+		else
+			retry = wait - queue
+		end
+		remaining = math.max(0, math.floor((queue + interval - (a - now)) / interval))
+		reset = math.max(0, a - now)
+		expires = a
+
+	elseif alg == 'fixed-window' then
+		local window = now - now % period
+		if a ~= window then
+			c, a = 0, window
+		end
+		reset = window + period - now
+		if c < limit then
+			c = c + 1
+			ok = 1
+		else
+			retry = reset
+		end
+		remaining = limit - c
+		expires = window + period
+
+	else
+		local window = now - now % period
+		if a == window - period then
+			p, c = c, 0
+		elseif a ~= window then
+			p, c = 0, 0
+		end
+		a = window
+		local estimated = p * (1 - (now - window) / period) + c
+		if estimated + 1 <= limit then
+			c = c + 1
+			estimated = estimated + 1
+			ok = 1
+		elseif c + 1 > limit then
+			retry = (window + period - now) + period * (1 - (limit - 1) / c)
+		else
+			retry = period * (1 - (limit - c - 1) / p) - (now - window)
+		end
+		remaining = math.max(0, math.floor(limit - estimated))
+		if c > 0 then
+			reset = window + 2 * period - now
+		else
+			reset = window + period - now
+		end
+		expires = window + 2 * period
+	end
+
+	if ok == 0 then
+		allowed = 0
+	end
+	states[i] = {c, p, a, expires}
+	local base = (i - 1) * 6
+	results[base + 1] = ok
+	results[base + 2] = limit
+	results[base + 3] = remaining
+	results[base + 4] = math.ceil(reset)
+	results[base + 5] = math.ceil(retry)
+	results[base + 6] = math.ceil(delay)
+end
+
+if allowed == 1 then
+	for i, key in ipairs(KEYS) do
+		local s = states[i]
+		redis.call('HMSET', key,
+			'c', string.format('%.17g', s[1]),
+			'p', string.format('%.17g', s[2]),
+			'a', string.format('%.0f', s[3]))
+		redis.call('PEXPIRE', key, math.max(1, math.ceil((s[4] - now) / 1000)))
+	end
+end
+return results
+`
+
+var takeScriptSHA = func() string {
+	sum := sha1.Sum([]byte(takeScript))
+	return hex.EncodeToString(sum[:])
+}()
+
+// redisStore keeps the limiter state in redis, so that the quota is
+// shared by all the instances of the gateway. Requests are limited
+// locally while the redis server is unreachable
+type redisStore struct {
+	client   *redisClient
+	prefix   string
+	strategy string
+	rates    []Rate
+	fallback *memoryStore
+
+	mu        sync.Mutex
+	downUntil time.Time
+}
+
+func newRedisStore(service string, conf Config, alg algorithm, rates []Rate) (*redisStore, error) {
+	rc := RedisConfig{}
+	if conf.Redis != nil {
+		rc = *conf.Redis
+	}
+	if rc.Timeout < 0 || rc.MaxIdle < 0 || rc.DB < 0 {
+		return nil, errors.New("redis values can not be negative")
+	}
+	if rc.Address == "" {
+		rc.Address = defaultRedisAddress
+	}
+	if rc.Timeout == 0 {
+		rc.Timeout = defaultRedisTimeout
+	}
+	if rc.MaxIdle == 0 {
+		rc.MaxIdle = defaultRedisMaxIdle
+	}
+	if rc.Prefix == "" {
+		rc.Prefix = defaultRedisPrefix
+	}
+
+	return &redisStore{
+		client: &redisClient{
+			address:  rc.Address,
+			password: rc.Password,
+			db:       rc.DB,
+			timeout:  time.Duration(rc.Timeout) * time.Millisecond,
+			maxIdle:  rc.MaxIdle,
+			dialer:   &net.Dialer{},
+		},
+		prefix:   rc.Prefix + service + ":",
+		strategy: conf.Strategy,
+		rates:    rates,
+		fallback: newMemoryStore(alg, rates),
+	}, nil
+}
+
+func (s *redisStore) Take(key string) (Result, error) {
+	s.mu.Lock()
+	down := time.Now().Before(s.downUntil)
+	s.mu.Unlock()
+	if down {
+		return s.fallback.Take(key)
+	}
+
+	res, err := s.take(key)
+	if err == nil {
+		return res, nil
+	}
+
+	s.mu.Lock()
+	// only the first failure is logged, till the server is tried again
+	if time.Now().After(s.downUntil) {
+		s.downUntil = time.Now().Add(redisRetryInterval)
+		logger.Warn(
+			"limiter: redis unreachable, limiting locally",
+			"address", s.client.address, "retry_in", redisRetryInterval.String(), "error", err,
+		)
+	}
+	s.mu.Unlock()
+	return s.fallback.Take(key)
+}
+
+func (s *redisStore) take(key string) (Result, error) {
+	keys := make([]string, len(s.rates))
+	args := []string{strconv.Itoa(len(keys))}
+	for i, rate := range s.rates {
+		keys[i] = s.prefix + key + ":" + s.strategy + ":" + rate.String()
+	}
+	args = append(args, keys...)
+	args = append(args, strconv.FormatInt(time.Now().UnixNano()/1000, 10), s.strategy)
+	for _, rate := range s.rates {
+		args = append(args,
+			strconv.FormatInt(rate.Limit, 10),
+			strconv.FormatInt(int64(rate.Period/time.Microsecond), 10),
+			strconv.FormatInt(int64(rate.maxDelay/time.Microsecond), 10),
+		)
+	}
+
+	reply, err := s.client.do(append([]string{"EVALSHA", takeScriptSHA}, args...)...)
+	if err != nil && strings.HasPrefix(err.Error(), "NOSCRIPT") {
+		reply, err = s.client.do(append([]string{"EVAL", takeScript}, args...)...)
+	}
+	if err != nil {
+		return Result{}, err
+	}
+
+	values, ok := reply.([]interface{})
+	if !ok || len(values) != 6*len(s.rates) {
+		return Result{}, fmt.Errorf("unexpected reply of limiter script `%v`", reply)
+	}
+	results := make([]Result, len(s.rates))
+	for i := range results {
+		var n [6]int64
+		for j := range n {
+			if n[j], ok = values[6*i+j].(int64); !ok {
+				return Result{}, fmt.Errorf("unexpected reply of limiter script `%v`", reply)
+			}
+		}
+		results[i] = Result{
+			Allowed:    n[0] == 1,
+			Limit:      n[1],
+			Remaining:  n[2],
+			Reset:      time.Duration(n[3]) * time.Microsecond,
+			RetryAfter: time.Duration(n[4]) * time.Microsecond,
+			Delay:      time.Duration(n[5]) * time.Microsecond,
+		}
+	}
+	return mergeResults(results), nil
+}
+
+// Cleanup removes the expired keys of the fallback store.
+// Keys in redis expire by themselves
+func (s *redisStore) Cleanup() (removed, total int) {
+	return s.fallback.Cleanup()
+}
+
+func (s *redisStore) closeIdle() {
+	s.client.closeIdle()
+}
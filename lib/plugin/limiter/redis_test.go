@@ -0,0 +1,231 @@
+package limiter
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+// fakeRedis is an in-process stand-in of the redis server. It does not run
+// the lua script, it counts the requests of every key like a fixed window
+// which never resets. Scripts are known to it only once they are sent by EVAL
+type fakeRedis struct {
+	listener net.Listener
+
+	mu       sync.Mutex
+	commands []string
+	scripts  map[string]bool
+	counts   map[string]int64
+}
+
+func newFakeRedis(t *testing.T) *fakeRedis {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("could not listen: %s", err)
+	}
+	s := &fakeRedis{listener: l, scripts: map[string]bool{}, counts: map[string]int64{}}
+	t.Cleanup(func() { l.Close() })
+
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go s.serve(conn)
+		}
+	}()
+	return s
+}
+
+func (s *fakeRedis) addr() string {
+	return s.listener.Addr().String()
+}
+
+func (s *fakeRedis) serve(conn net.Conn) {
+	defer conn.Close()
+	r, w := bufio.NewReader(conn), bufio.NewWriter(conn)
+	for {
+		req, err := readReply(r)
+		if err != nil {
+			return
+		}
+		values, ok := req.([]interface{})
+		if !ok || len(values) == 0 {
+			return
+		}
+		args := make([]string, len(values))
+		for i, v := range values {
+			args[i] = string(v.([]byte))
+		}
+
+		w.WriteString(s.reply(args))
+		if err := w.Flush(); err != nil {
+			return
+		}
+	}
+}
+
+func (s *fakeRedis) reply(args []string) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.commands = append(s.commands, args[0])
+	switch args[0] {
+	case "EVAL":
+		sum := sha1.Sum([]byte(args[1]))
+		s.scripts[hex.EncodeToString(sum[:])] = true
+	case "EVALSHA":
+		if !s.scripts[args[1]] {
+			return "-NOSCRIPT No matching script. Please use EVAL.\r\n"
+		}
+	default:
+		return fmt.Sprintf("-ERR unknown command '%s'\r\n", args[0])
+	}
+
+	// args are script, numkeys, keys, now, algorithm and limit, period, max delay of each rate
+	numKeys, _ := strconv.Atoi(args[2])
+	keys := args[3 : 3+numKeys]
+	rateArgs := args[5+numKeys:]
+
+	allowed := int64(1)
+	for i, key := range keys {
+		limit, _ := strconv.ParseInt(rateArgs[3*i], 10, 64)
+		if s.counts[key] >= limit {
+			allowed = 0
+		}
+	}
+
+	reply := fmt.Sprintf("*%d\r\n", 6*len(keys))
+	for i, key := range keys {
+		limit, _ := strconv.ParseInt(rateArgs[3*i], 10, 64)
+		if allowed == 1 {
+			s.counts[key]++
+		}
+		for _, n := range []int64{allowed, limit, limit - s.counts[key], 0, 0, 0} {
+			reply += fmt.Sprintf(":%d\r\n", n)
+		}
+	}
+	return reply
+}
+
+func (s *fakeRedis) calls() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string{}, s.commands...)
+}
+
+// countingDialer counts the connections dialed by the client
+type countingDialer struct {
+	net.Dialer
+	dials int64
+}
+
+func (d *countingDialer) DialContext(ctx context.Context, network, address string) (net.Conn, error) {
+	atomic.AddInt64(&d.dials, 1)
+	return d.Dialer.DialContext(ctx, network, address)
+}
+
+func newTestRedisStore(t *testing.T, address string, specs ...string) *redisStore {
+	rates, err := parseRates(specs)
+	if err != nil {
+		t.Fatalf("invalid rates: %s", err)
+	}
+	alg, err := getAlgorithm(FixedWindow)
+	if err != nil {
+		t.Fatalf("invalid algorithm: %s", err)
+	}
+	conf := Config{Strategy: FixedWindow, Storage: StorageRedis, Redis: &RedisConfig{Address: address}}
+	s, err := newRedisStore("test", conf, alg, rates)
+	if err != nil {
+		t.Fatalf("could not create redis store: %s", err)
+	}
+	t.Cleanup(s.closeIdle)
+	return s
+}
+
+func TestRedisStoreLoadsScriptOnNoScript(t *testing.T) {
+	server := newFakeRedis(t)
+	s := newTestRedisStore(t, server.addr(), "2/M")
+
+	for i := 0; i < 2; i++ {
+		res, err := s.Take("client")
+		if err != nil {
+			t.Fatalf("take %d failed: %s", i+1, err)
+		}
+		if !res.Allowed {
+			t.Fatalf("take %d is not allowed", i+1)
+		}
+	}
+
+	// script is sent by EVAL only once, when the server does not know it
+	want := []string{"EVALSHA", "EVAL", "EVALSHA"}
+	if got := server.calls(); fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("got commands %v, want %v", got, want)
+	}
+	server.mu.Lock()
+	defer server.mu.Unlock()
+	if !server.scripts[takeScriptSHA] {
+		t.Errorf("script sent by EVAL does not match the sha sent by EVALSHA")
+	}
+}
+
+func TestRedisStoreLimits(t *testing.T) {
+	server := newFakeRedis(t)
+	s := newTestRedisStore(t, server.addr(), "2/M", "10/H")
+
+	for i, wantAllowed := range []bool{true, true, false} {
+		res, err := s.Take("client")
+		if err != nil {
+			t.Fatalf("take %d failed: %s", i+1, err)
+		}
+		if res.Allowed != wantAllowed {
+			t.Errorf("take %d: got allowed %t, want %t", i+1, res.Allowed, wantAllowed)
+		}
+		// most restrictive rate is reported
+		if res.Limit != 2 {
+			t.Errorf("take %d: got limit %d, want 2", i+1, res.Limit)
+		}
+	}
+
+	// keys are limited separately
+	if res, err := s.Take("other"); err != nil || !res.Allowed {
+		t.Errorf("take of other key: got allowed %t, error %v", res.Allowed, err)
+	}
+}
+
+func TestRedisStoreFallsBackToLocalWhenDown(t *testing.T) {
+	// address of a closed listener refuses the connections
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("could not listen: %s", err)
+	}
+	address := l.Addr().String()
+	l.Close()
+
+	s := newTestRedisStore(t, address, "2/M")
+	d := &countingDialer{}
+	s.client.dialer = d
+
+	for i, wantAllowed := range []bool{true, true, false} {
+		res, err := s.Take("client")
+		if err != nil {
+			t.Fatalf("take %d failed: %s", i+1, err)
+		}
+		if res.Allowed != wantAllowed {
+			t.Errorf("take %d: got allowed %t, want %t", i+1, res.Allowed, wantAllowed)
+		}
+	}
+
+	// server is not tried again till the retry interval passes
+	if dials := atomic.LoadInt64(&d.dials); dials != 1 {
+		t.Errorf("got %d dials, want 1", dials)
+	}
+}
@@ -1,76 +1,267 @@
 package limiter
 
 import (
+	"errors"
 	"fmt"
 	"net/http"
 	"strconv"
+	"strings"
+	"time"
 
-	"github.com/AyushSenapati/limiter"
-
+	"github.com/AyushSenapati/guardian/lib/consumer"
+	"github.com/AyushSenapati/guardian/lib/logger"
+	"github.com/AyushSenapati/guardian/lib/metrics"
+	"github.com/AyushSenapati/guardian/lib/plugin/pluginconf"
 	"github.com/AyushSenapati/guardian/lib/proxy"
 )
 
 const (
 	limiterHeaderLimit     = "X-RateLimit-Limit"
 	limiterHeaderRemaining = "X-RateLimit-Remaining"
+	limiterHeaderReset     = "X-RateLimit-Reset"
 )
 
+// defaultMaxDelay is the longest a request is queued by leaky bucket,
+// unless configured. It is below the default write timeout of the server,
+// so that the client gets 429 instead of the connection being closed
+const defaultMaxDelay = 10000 // in millisecond(s)
+
+// consumerPlanKey is the consumer metadata naming the plan of the consumer
+const consumerPlanKey = "plan"
+
+// depending on rate limit type set default quota if nothing is provided
+var defaultQuota = map[string]int64{
+	"s": 2,
+	"m": 15,
+	"h": 100,
+}
+
 // Config defines limiter config
 type Config struct {
-	Quota int64
-	Per   string
-	Store string
+	// Strategy is the algorithm used to limit the requests.
+	// Defaults to fixed-window
+	Strategy string `json:"strategy"`
+	// Storage can be local or redis. Defaults to local
+	Storage string `json:"storage"`
+	// Redis is used by redis storage
+	Redis *RedisConfig `json:"redis,omitempty"`
+	// Policy decides what the requests are limited by. Defaults to IP.
+	// Policies can be composed like consumer+header:X-Tenant-ID
+	Policy string `json:"policy"`
+	// Rates like 5/1-M. Request has to be allowed by all of them
+	Rates []string `json:"rates"`
+	// Plans map the plans to their rates. Requests of the consumers
+	// are limited by the rates of the plan in their plan metadata
+	Plans map[string][]string `json:"plans"`
+	// Consumers map the consumers to their rates,
+	// overriding the rates of their plan
+	Consumers map[string][]string `json:"consumers"`
+	// Quota per s/m/h is the rate, if rates are not configured
+	Quota int64  `json:"quota"`
+	Per   string `json:"per"`
+	// MaxDelay is the longest a request is queued by leaky bucket, in
+	// millisecond(s). Requests which would wait longer are rejected.
+	// It should be less than the write timeout of the server
+	MaxDelay int `json:"max_delay"`
+}
+
+// limiter limits the requests of a service. Requests of the consumers
+// having their own rates are limited by the stores of their tier
+type limiter struct {
+	service   string
+	key       limiterKey
+	store     Store
+	plans     map[string]Store
+	consumers map[string]Store
 }
 
 // SetupLimiter implements the logic to read the provided raw config and configure itself
 func SetupLimiter(def *proxy.RouterDefinition, rawConfig map[string]interface{}) error {
-	// var config Config
-
-	// validJSON, err := json.Marshal(rawConfig)
-	// if err != nil {
-	// 	return err
-	// }
-	// if err := json.Unmarshal(validJSON, &config); err != nil {
-	// 	return err
-	// }
-	config, err := limiter.ParseAndLoadConfiguration(rawConfig)
+	var config Config
+	if err := pluginconf.Decode(rawConfig, &config); err != nil {
+		return err
+	}
+
+	l, err := newLimiter(def.Name, config)
 	if err != nil {
 		return err
 	}
-	l := limiter.NewWithConfiguration(config)
-	l.Configure()
-	def.AddMiddleware(l.Handler())
-	// def.AddMiddleware(configureLimiterMW(config))
+	// stores are cleaned only while the limiter is in use
+	c := newCleaner(def.Name, l.stores())
+	def.OnCommit(c.start)
+	def.OnClose(c.close)
 
+	def.AddMiddleware(l.handler)
 	return nil
 }
 
-func configureLimiterMW(config Config) func(http.Handler) http.Handler {
-	store := NewMemoryStore(config)
-	storeCleaner.addStore(store)
-	storeCleaner.dispatchCleaner()
-
-	return func(next http.Handler) http.Handler {
-		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			// Get source IP from request header
-			ipAddr := getIP(r)
-			if ipAddr == "" {
-				w.Write([]byte("Malformed request IP detected"))
-				w.WriteHeader(http.StatusBadRequest)
-				return
-			}
+func newLimiter(service string, config Config) (*limiter, error) {
+	if config.Strategy == "" {
+		config.Strategy = FixedWindow
+	}
+	alg, err := getAlgorithm(config.Strategy)
+	if err != nil {
+		return nil, err
+	}
+	if config.MaxDelay < 0 {
+		return nil, errors.New("max_delay can not be negative")
+	}
+	if config.MaxDelay == 0 {
+		config.MaxDelay = defaultMaxDelay
+	}
+
+	key, err := parsePolicy(config.Policy)
+	if err != nil {
+		return nil, err
+	}
+
+	rates, err := config.rates()
+	if err != nil {
+		return nil, err
+	}
+	l := &limiter{
+		service:   service,
+		key:       key,
+		plans:     make(map[string]Store),
+		consumers: make(map[string]Store),
+	}
+	if l.store, err = newStore(service, config, alg, rates); err != nil {
+		return nil, err
+	}
+
+	for plan, specs := range config.Plans {
+		if l.plans[plan], err = newTierStore(service, config, alg, specs); err != nil {
+			return nil, fmt.Errorf("invalid rates of plan `%s` [%s]", plan, err)
+		}
+	}
+	for name, specs := range config.Consumers {
+		if l.consumers[name], err = newTierStore(service, config, alg, specs); err != nil {
+			return nil, fmt.Errorf("invalid rates of consumer `%s` [%s]", name, err)
+		}
+	}
+	return l, nil
+}
+
+func newTierStore(service string, config Config, alg algorithm, specs []string) (Store, error) {
+	if len(specs) == 0 {
+		return nil, errors.New("rates can not be empty")
+	}
+	rates, err := parseRates(specs)
+	if err != nil {
+		return nil, err
+	}
+	return newStore(service, config, alg, rates)
+}
+
+// stores returns all the stores of the limiter
+func (l *limiter) stores() []Store {
+	stores := []Store{l.store}
+	for _, s := range l.plans {
+		stores = append(stores, s)
+	}
+	for _, s := range l.consumers {
+		stores = append(stores, s)
+	}
+	return stores
+}
+
+// storeFor returns the store limiting the request. Rates of the consumer
+// take precedence over the rates of its plan, which take precedence
+// over the rates of the service
+func (l *limiter) storeFor(r *http.Request) Store {
+	c, ok := consumer.FromCtx(r.Context())
+	if !ok {
+		return l.store
+	}
+	if s, found := l.consumers[c.Name]; found {
+		return s
+	}
+	if s, found := l.plans[c.Metadata[consumerPlanKey]]; found {
+		return s
+	}
+	return l.store
+}
 
-			w.Header().Set(
-				limiterHeaderLimit, fmt.Sprintf("%d/%s", config.Quota, config.Per),
-			)
-			quotaRemaining, isAllowed := store.IsAllowed(ipAddr)
-			w.Header().Set(limiterHeaderRemaining, strconv.Itoa(int(quotaRemaining)))
-			if !isAllowed {
-				w.WriteHeader(http.StatusTooManyRequests)
+// rates returns the parsed rates of the config
+func (c *Config) rates() ([]Rate, error) {
+	if len(c.Rates) > 0 {
+		if c.Quota != 0 || c.Per != "" {
+			return nil, errors.New("quota and per can not be used along with rates")
+		}
+		return parseRates(c.Rates)
+	}
+
+	per := strings.ToLower(c.Per)
+	quota, found := defaultQuota[per]
+	if !found {
+		return nil, fmt.Errorf("unsupported rate limit type `%s`, should be of (per s/m/h)", c.Per)
+	}
+	if c.Quota < 0 {
+		return nil, errors.New("quota can not be negative")
+	}
+	if c.Quota > 0 {
+		quota = c.Quota
+	}
+	rate, err := ParseRate(fmt.Sprintf("%d/%s", quota, per))
+	if err != nil {
+		return nil, err
+	}
+	return []Rate{rate}, nil
+}
+
+func parseRates(specs []string) ([]Rate, error) {
+	rates := make([]Rate, 0, len(specs))
+	for _, spec := range specs {
+		rate, err := ParseRate(spec)
+		if err != nil {
+			return nil, err
+		}
+		rates = append(rates, rate)
+	}
+	return rates, nil
+}
+
+func (l *limiter) handler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key := l.key.resolve(r)
+		if key == "" {
+			http.Error(w, "Malformed request IP detected", http.StatusBadRequest)
+			return
+		}
+
+		res, err := l.storeFor(r).Take(key)
+		if err != nil {
+			// requests are let through, so that an unavailable
+			// store does not take the service down
+			logger.FromCtx(r.Context()).Error("limiter: could not take request", "error", err)
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		h := w.Header()
+		h.Set(limiterHeaderLimit, strconv.FormatInt(res.Limit, 10))
+		h.Set(limiterHeaderRemaining, strconv.FormatInt(res.Remaining, 10))
+		h.Set(limiterHeaderReset, strconv.FormatInt(ceilSeconds(res.Reset), 10))
+		if !res.Allowed {
+			metrics.LimiterRejections.With(l.service).Inc()
+			h.Set("Retry-After", strconv.FormatInt(ceilSeconds(res.RetryAfter), 10))
+			http.Error(w, http.StatusText(http.StatusTooManyRequests), http.StatusTooManyRequests)
+			return
+		}
+
+		if res.Delay > 0 {
+			timer := time.NewTimer(res.Delay)
+			select {
+			case <-timer.C:
+			case <-r.Context().Done():
+				timer.Stop()
 				return
 			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
 
-			next.ServeHTTP(w, r)
-		})
-	}
+func ceilSeconds(d time.Duration) int64 {
+	return int64((d + time.Second - 1) / time.Second)
 }
@@ -1,181 +1,197 @@
 package limiter
 
 import (
-	"log"
+	"errors"
+	"fmt"
 	"sync"
 	"time"
+
+	"github.com/AyushSenapati/guardian/lib/logger"
 )
 
-// depending on rate limit type set default quota if nothing is provided
-var defaultQuota = map[string]int64{
-	"s": 2,
-	"m": 15,
-	"h": 100,
-}
+// supported storages
+const (
+	StorageLocal = "local"
+	StorageRedis = "redis"
+)
 
-var defaultDuration = map[string]time.Duration{
-	"s": time.Second,
-	"m": time.Minute,
-	"h": time.Hour,
+// cleanupInterval is how often the cleaner removes the expired keys
+const cleanupInterval = time.Minute
+
+// Store keeps the limiter state of the keys
+type Store interface {
+	// Take counts a request of the key against all the rates and reports
+	// if it is allowed. Request rejected by any of the rates is not
+	// counted against the others
+	Take(key string) (Result, error)
+	// Cleanup removes the expired keys and returns
+	// number of removed keys and total keys
+	Cleanup() (removed, total int)
 }
 
-var storeCleaner = cleaner{active: false}
-
-// it is the global limiter store cleaner. at specific interval it scans
-// registered stores for invalid keys and removes them
-type cleaner struct {
-	sync.RWMutex
-	active bool
-	stores []*MemoryStore
-}
+// newStore returns the store of the limiter config
+func newStore(service string, conf Config, alg algorithm, rates []Rate) (Store, error) {
+	if conf.Redis != nil && conf.Storage != StorageRedis {
+		return nil, errors.New("redis config can only be used with redis storage")
+	}
 
-// Store interface defines basic functionalities of a store
-// type Store interface {
-// 	Get(key string) int64
-// 	Set(key string, deadline int64) bool
-// }
-
-// // NewStore takes limiter config and returns appropriate interface to access store
-// func NewStore(conf Config) Store {
-// 	switch conf.Store {
-// 	case "local":
-// 		return NewMemoryStore(conf)
-// 	default:
-// 		log.Printf("limiter: store %s is not supported. using local store", conf.Store)
-// 		return NewMemoryStore(conf)
-// 	}
-// }
-
-// MemoryStore is the local memory store which holds limiter info
-type MemoryStore struct {
-	sync.RWMutex
-	database    map[string]*Limit
-	quota       int64
-	limiterType string
-}
+	maxDelay := time.Duration(conf.MaxDelay) * time.Millisecond
+	for i := range rates {
+		rates[i].maxDelay = maxDelay
+	}
 
-// NewMemoryStore returns a Memory Store
-func NewMemoryStore(conf Config) *MemoryStore {
-	s := MemoryStore{
-		database:    make(map[string]*Limit),
-		quota:       getValidQuota(conf.Quota, conf.Per),
-		limiterType: conf.Per,
+	switch conf.Storage {
+	case "", StorageLocal:
+		return newMemoryStore(alg, rates), nil
+	case StorageRedis:
+		return newRedisStore(service, conf, alg, rates)
+	default:
+		return nil, fmt.Errorf(
+			"unsupported storage `%s`, should be of (%s/%s)", conf.Storage, StorageLocal, StorageRedis)
 	}
-	return &s
 }
 
-func getValidQuota(quota int64, limiterType string) int64 {
-	q, found := defaultQuota[limiterType]
-	if !found {
-		log.Fatal("unsupported rate limit type. should be of (per s/m/h)")
-	}
-	if quota <= 0 {
-		quota = q
-	}
-	return quota
+// memoryStore is the local memory store which holds limiter info
+type memoryStore struct {
+	sync.Mutex
+	database map[string][]state
+	alg      algorithm
+	rates    []Rate
 }
 
-// Get retrieves key from the storage
-func (s *MemoryStore) Get(key string) (*Limit, bool) {
-	s.RLock()
-	defer s.RUnlock()
-	limit, found := s.database[key]
-	return limit, found
+func newMemoryStore(alg algorithm, rates []Rate) *memoryStore {
+	return &memoryStore{
+		database: make(map[string][]state),
+		alg:      alg,
+		rates:    rates,
+	}
 }
 
-// Upsert sets provided limit to the key in the storage
-func (s *MemoryStore) Upsert(key string, limit *Limit) {
+func (s *memoryStore) Take(key string) (Result, error) {
 	s.Lock()
 	defer s.Unlock()
-	s.database[key] = limit
-}
 
-// IsAllowed takes key, returns remaining quota and
-// bool stating if the request should be allowed
-func (s *MemoryStore) IsAllowed(key string) (int64, bool) {
-	limit, _ := s.Get(key)
-
-	// If there is an entry check if deadline is exceeded
-	if limit.IsDeadlineExceeded() {
-		limit = limit.New(s.limiterType, s.quota)
-		limit.Left--
-		s.Upsert(key, limit)
-		return limit.Left, true
+	now := time.Now().UnixNano()
+	current := s.database[key]
+	if current == nil {
+		current = make([]state, len(s.rates))
 	}
 
-	// Check if there is quota left
-	if limit.IsQuotaExceeded() {
-		return limit.Left, false
+	updated := make([]state, len(s.rates))
+	results := make([]Result, len(s.rates))
+	for i, rate := range s.rates {
+		updated[i], results[i] = s.alg(current[i], rate, now)
 	}
 
-	limit.Left--
-	return limit.Left, true
+	res := mergeResults(results)
+	if res.Allowed {
+		s.database[key] = updated
+	}
+	return res, nil
 }
 
-func (c *cleaner) addStore(store *MemoryStore) bool {
-	c.Lock()
-	defer c.Unlock()
+func (s *memoryStore) Cleanup() (removed, total int) {
+	s.Lock()
+	defer s.Unlock()
 
-	for _, s := range c.stores {
-		if s == store {
-			log.Println("limiter: (cleanup) we are already tracking this store")
+	now := time.Now().UnixNano()
+	for key, states := range s.database {
+		total++
+		if expired(states, now) {
+			delete(s.database, key)
+			removed++
+		}
+	}
+	return removed, total
+}
+
+func expired(states []state, now int64) bool {
+	for _, s := range states {
+		if s.Expires > now {
 			return false
 		}
 	}
-	c.stores = append(c.stores, store)
 	return true
 }
 
-func (c *cleaner) getStores() []*MemoryStore {
-	c.RLock()
-	defer c.RUnlock()
+// mergeResults merges the results of all the rates into one. Request is
+// allowed only if all the rates allow it, and the most restrictive rate
+// decides the quota reported to the client
+func mergeResults(results []Result) Result {
+	res := results[0]
+	res.Allowed = true
+	for _, r := range results {
+		res.Allowed = res.Allowed && r.Allowed
+		if r.Remaining < res.Remaining {
+			res.Limit, res.Remaining = r.Limit, r.Remaining
+		}
+		if r.Reset > res.Reset {
+			res.Reset = r.Reset
+		}
+		if r.RetryAfter > res.RetryAfter {
+			res.RetryAfter = r.RetryAfter
+		}
+		if r.Delay > res.Delay {
+			res.Delay = r.Delay
+		}
+	}
+	if !res.Allowed {
+		res.Delay = 0
+	}
+	return res
+}
 
-	return c.stores
+// cleaner removes the expired keys of the stores of a limiter at specific
+// interval. It is started once the limiter serves requests, and stopped
+// along with the register the limiter belongs to
+type cleaner struct {
+	service string
+	stores  []Store
+	stop    chan struct{}
 }
 
-func (c *cleaner) dispatchCleaner() {
-	log.Println("limiter: (cleanup) dispatching service")
-	if c.active {
-		log.Println("limiter: (cleanup) service already running")
-		return
-	}
+func newCleaner(service string, stores []Store) *cleaner {
+	return &cleaner{service: service, stores: stores, stop: make(chan struct{})}
+}
 
-	duration, found := defaultDuration["m"]
-	if !found {
-		log.Fatal("unsupported rate limit type. should be of (per s/m/h)")
-	}
-	minuteTicker := time.NewTicker(duration)
+func (c *cleaner) start() {
+	logger.Debug("limiter: (cleanup) dispatching service", "service", c.service)
 
+	ticker := time.NewTicker(cleanupInterval)
 	go func() {
+		defer ticker.Stop()
 		for {
-			<-minuteTicker.C
-			stores := c.getStores()
-			for i, s := range stores {
-				sTime := time.Now().UnixNano()
-				i++
-				deletedKeys, totalKeys := doCleanup(s)
-				log.Printf(
-					"limiter: (cleanup) store[%d/%d] %d/%d keys are deleted in %d ns",
-					i, len(stores), deletedKeys, totalKeys, time.Now().UnixNano()-sTime)
+			select {
+			case <-c.stop:
+				return
+			case <-ticker.C:
+				c.cleanup()
 			}
 		}
 	}()
-
-	c.active = true
-	log.Println("limiter: (cleanup) service dispatched")
 }
 
-func doCleanup(s *MemoryStore) (count, total int) {
-	s.Lock()
-	defer s.Unlock()
+func (c *cleaner) cleanup() {
+	sTime := time.Now().UnixNano()
+	var deletedKeys, totalKeys int
+	for _, s := range c.stores {
+		deleted, total := s.Cleanup()
+		deletedKeys, totalKeys = deletedKeys+deleted, totalKeys+total
+	}
+	logger.Debug(
+		"limiter: (cleanup) store cleaned",
+		"service", c.service, "deleted_keys", deletedKeys,
+		"total_keys", totalKeys, "duration_ns", time.Now().UnixNano()-sTime,
+	)
+}
 
-	for key, limit := range s.database {
-		if limit.IsDeadlineExceeded() {
-			delete(s.database, key)
-			count++
+// close stops the cleaner and releases the idle connections of the stores.
+// They can still be used by the requests in flight, which dial again if needed
+func (c *cleaner) close() {
+	close(c.stop)
+	for _, store := range c.stores {
+		if s, ok := store.(interface{ closeIdle() }); ok {
+			s.closeIdle()
 		}
-		total++
 	}
-
-	return
 }
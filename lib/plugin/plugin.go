@@ -3,6 +3,13 @@ package plugin
 import (
 	"fmt"
 
+	"github.com/AyushSenapati/guardian/lib/plugin/cache"
+	"github.com/AyushSenapati/guardian/lib/plugin/circuitbreaker"
+	"github.com/AyushSenapati/guardian/lib/plugin/cors"
+	"github.com/AyushSenapati/guardian/lib/plugin/headertransform"
+	"github.com/AyushSenapati/guardian/lib/plugin/iprestriction"
+	"github.com/AyushSenapati/guardian/lib/plugin/jwt"
+	"github.com/AyushSenapati/guardian/lib/plugin/keyauth"
 	"github.com/AyushSenapati/guardian/lib/plugin/limiter"
 	"github.com/AyushSenapati/guardian/lib/proxy"
 )
@@ -16,7 +23,47 @@ type registry map[string]SetupFunc
 
 // register keeps all the active plugins
 var register = registry{
-	"limiter": limiter.SetupLimiter,
+	"limiter":          limiter.SetupLimiter,
+	"jwt":              jwt.SetupJWT,
+	"key-auth":         keyauth.SetupKeyAuth,
+	"circuit-breaker":  circuitbreaker.SetupCircuitBreaker,
+	"header-transform": headertransform.SetupHeaderTransform,
+	"cors":             cors.SetupCORS,
+	"cache":            cache.SetupCache,
+	"ip-restriction":   iprestriction.SetupIPRestriction,
+}
+
+// authPlugins identify the consumers of the requests
+var authPlugins = map[string]bool{
+	"jwt":      true,
+	"key-auth": true,
+}
+
+// ValidateOrder checks if the plugins of a service are listed in an order
+// they can work in. Cache must be listed after the auth plugins, so that
+// cached responses are not served to the requests before they are
+// authenticated. CORS must be listed before them, as preflight requests
+// do not carry the credentials
+func ValidateOrder(names []string) error {
+	firstAuth, lastAuth := -1, -1
+	for i, name := range names {
+		if authPlugins[name] {
+			if firstAuth < 0 {
+				firstAuth = i
+			}
+			lastAuth = i
+		}
+	}
+
+	for i, name := range names {
+		switch {
+		case name == "cache" && i < lastAuth:
+			return fmt.Errorf("plugin `%s` must be listed after the auth plugin `%s`", name, names[lastAuth])
+		case name == "cors" && firstAuth >= 0 && i > firstAuth:
+			return fmt.Errorf("plugin `%s` must be listed before the auth plugin `%s`", name, names[firstAuth])
+		}
+	}
+	return nil
 }
 
 // GetSetupFunc returns SetupFunc for the requested plugin name
@@ -0,0 +1,24 @@
+package pluginconf
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+)
+
+// Decode decodes the raw plugin config found in the service definition
+// into the given plugin specific config. Unknown fields are reported,
+// so that typos in the service definitions do not go unnoticed
+func Decode(rawConfig map[string]interface{}, config interface{}) error {
+	validJSON, err := json.Marshal(rawConfig)
+	if err != nil {
+		return err
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(validJSON))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(config); err != nil {
+		return fmt.Errorf("invalid config [%s]", err)
+	}
+	return nil
+}
@@ -0,0 +1,277 @@
+package proxy
+
+import (
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"sync"
+	"sync/atomic"
+
+	"github.com/AyushSenapati/guardian/lib/realip"
+)
+
+// supported load balancing strategies
+const (
+	RoundRobin         = "round-robin"
+	WeightedRoundRobin = "weighted-round-robin"
+	LeastConnections   = "least-connections"
+	Random             = "random"
+	ConsistentHash     = "consistent-hash"
+)
+
+// sources of the key consistent hashing is done on
+const (
+	HashOnHeader = "header"
+	HashOnCookie = "cookie"
+	HashOnIP     = "ip"
+)
+
+// number of points each unit of weight gets on the consistent hash ring
+const replicasPerWeight = 100
+
+var errNoTarget = errors.New("no healthy upstream target available")
+
+// target is the runtime representation of an upstream target
+type target struct {
+	url    *url.URL
+	weight int
+	active int64 // number of requests being served, accessed atomically
+
+	health  health
+	passive *PassiveHealthCheck
+}
+
+func newTargets(def *Definition) ([]*target, error) {
+	var targetDefs []*Target
+	var passive *PassiveHealthCheck
+	if def.Upstreams != nil {
+		targetDefs = def.Upstreams.Targets
+		if def.Upstreams.HealthCheck != nil {
+			passive = def.Upstreams.HealthCheck.withDefaults().Passive
+		}
+	}
+	if len(targetDefs) == 0 {
+		targetDefs = []*Target{{URL: def.Upstream, Weight: 1}}
+	}
+
+	targets := make([]*target, 0, len(targetDefs))
+	for _, td := range targetDefs {
+		u, err := url.Parse(td.URL)
+		if err != nil {
+			return nil, fmt.Errorf("invalid upstream target `%s` [%s]", td.URL, err)
+		}
+
+		weight := td.Weight
+		if weight <= 0 {
+			weight = 1
+		}
+		targets = append(targets, &target{url: u, weight: weight, passive: passive})
+	}
+	return targets, nil
+}
+
+// balancer elects one of the upstream targets for a request
+type balancer interface {
+	elect(req *http.Request) (*target, error)
+}
+
+func newBalancer(def *Definition, targets []*target) (balancer, error) {
+	var upstreams Upstreams
+	if def.Upstreams != nil {
+		upstreams = *def.Upstreams
+	}
+
+	switch upstreams.Balancing {
+	case "", RoundRobin:
+		return &roundRobin{targets: targets}, nil
+	case WeightedRoundRobin:
+		return newWeightedRoundRobin(targets), nil
+	case LeastConnections:
+		return &leastConnections{targets: targets}, nil
+	case Random:
+		return newRandom(targets), nil
+	case ConsistentHash:
+		return newConsistentHash(targets, upstreams.HashOn, upstreams.HashKey), nil
+	default:
+		return nil, fmt.Errorf("unsupported balancing strategy `%s`", upstreams.Balancing)
+	}
+}
+
+// roundRobin elects targets one after the other ignoring their weights
+type roundRobin struct {
+	targets []*target
+	next    uint64
+}
+
+func (b *roundRobin) elect(req *http.Request) (*target, error) {
+	for range b.targets {
+		n := atomic.AddUint64(&b.next, 1) - 1
+		if t := b.targets[n%uint64(len(b.targets))]; t.available() {
+			return t, nil
+		}
+	}
+	return nil, errNoTarget
+}
+
+// weightedRoundRobin implements smooth weighted round robin,
+// which spreads the elections of heavier targets instead of bursting them
+type weightedRoundRobin struct {
+	sync.Mutex
+	targets []*target
+	current []int
+}
+
+func newWeightedRoundRobin(targets []*target) *weightedRoundRobin {
+	return &weightedRoundRobin{targets: targets, current: make([]int, len(targets))}
+}
+
+func (b *weightedRoundRobin) elect(req *http.Request) (*target, error) {
+	b.Lock()
+	defer b.Unlock()
+
+	best, total := -1, 0
+	for i, t := range b.targets {
+		if !t.available() {
+			continue
+		}
+		b.current[i] += t.weight
+		total += t.weight
+		if best < 0 || b.current[i] > b.current[best] {
+			best = i
+		}
+	}
+	if best < 0 {
+		return nil, errNoTarget
+	}
+
+	b.current[best] -= total
+	return b.targets[best], nil
+}
+
+// leastConnections elects the target serving least number of requests
+// relative to its weight
+type leastConnections struct {
+	targets []*target
+}
+
+func (b *leastConnections) elect(req *http.Request) (*target, error) {
+	var best *target
+	var bestLoad float64
+
+	for _, t := range b.targets {
+		if !t.available() {
+			continue
+		}
+		load := float64(atomic.LoadInt64(&t.active)) / float64(t.weight)
+		if best == nil || load < bestLoad {
+			best, bestLoad = t, load
+		}
+	}
+	if best == nil {
+		return nil, errNoTarget
+	}
+	return best, nil
+}
+
+// random elects a random target with probability proportional to its weight
+type random struct {
+	sync.Mutex
+	rnd     *rand.Rand
+	targets []*target
+}
+
+func newRandom(targets []*target) *random {
+	return &random{rnd: rand.New(rand.NewSource(rand.Int63())), targets: targets}
+}
+
+func (b *random) elect(req *http.Request) (*target, error) {
+	available := make([]*target, 0, len(b.targets))
+	total := 0
+	for _, t := range b.targets {
+		if t.available() {
+			available = append(available, t)
+			total += t.weight
+		}
+	}
+	if total == 0 {
+		return nil, errNoTarget
+	}
+
+	b.Lock()
+	n := b.rnd.Intn(total)
+	b.Unlock()
+
+	for _, t := range available {
+		if n < t.weight {
+			return t, nil
+		}
+		n -= t.weight
+	}
+	return nil, errNoTarget
+}
+
+// consistentHash elects targets using a hash ring, so that requests
+// having same key keep going to the same target as long as it is available
+type consistentHash struct {
+	hashOn  string
+	hashKey string
+	ring    []uint32
+	owners  map[uint32]*target
+}
+
+func newConsistentHash(targets []*target, hashOn, hashKey string) *consistentHash {
+	b := &consistentHash{hashOn: hashOn, hashKey: hashKey, owners: make(map[uint32]*target)}
+
+	for _, t := range targets {
+		for i := 0; i < t.weight*replicasPerWeight; i++ {
+			point := crc32.ChecksumIEEE([]byte(t.url.String() + "#" + strconv.Itoa(i)))
+			if _, taken := b.owners[point]; taken {
+				continue
+			}
+			b.owners[point] = t
+			b.ring = append(b.ring, point)
+		}
+	}
+	sort.Slice(b.ring, func(i, j int) bool { return b.ring[i] < b.ring[j] })
+
+	return b
+}
+
+func (b *consistentHash) elect(req *http.Request) (*target, error) {
+	if len(b.ring) == 0 {
+		return nil, errNoTarget
+	}
+
+	hash := crc32.ChecksumIEEE([]byte(b.key(req)))
+	i := sort.Search(len(b.ring), func(i int) bool { return b.ring[i] >= hash })
+
+	// walk the ring clockwise till an available target is found
+	for n := 0; n < len(b.ring); n++ {
+		if t := b.owners[b.ring[(i+n)%len(b.ring)]]; t.available() {
+			return t, nil
+		}
+	}
+	return nil, errNoTarget
+}
+
+// key returns the value consistent hashing is done on.
+// Requests missing the key are hashed on client IP
+func (b *consistentHash) key(req *http.Request) string {
+	switch b.hashOn {
+	case HashOnHeader:
+		if v := req.Header.Get(b.hashKey); v != "" {
+			return v
+		}
+	case HashOnCookie:
+		if c, err := req.Cookie(b.hashKey); err == nil && c.Value != "" {
+			return c.Value
+		}
+	}
+
+	return realip.ClientIP(req)
+}
@@ -1,22 +1,62 @@
 package proxy
 
 import (
+	"errors"
+	"fmt"
+	"net/url"
+
 	"github.com/AyushSenapati/guardian/lib/router"
 )
 
-// Definition defines proxy definition
+// Definition defines proxy definition. ListenPath can be an exact path,
+// a prefix ending with /*, a path with named params like /users/{id} or
+// /users/{id:[0-9]+}, or a regex starting with ~. Requests can further be
+// matched on Methods and on Headers, which map header names to their values.
+// Hosts make the service served only for the listed hosts, which can have
+// a leading wildcard like *.example.com. Services can share a listen path
+// as long as they are served for different hosts
 type Definition struct {
-	ListenPath   string `json:"listen_path"`
-	Upstream     string `json:"upstream"`
-	PreserveHost bool   `json:"preserve_host"`
-	StripPath    bool   `json:"strip_path"`
+	Hosts        []string          `json:"hosts,omitempty"`
+	ListenPath   string            `json:"listen_path"`
+	Methods      []string          `json:"methods,omitempty"`
+	Headers      map[string]string `json:"headers,omitempty"`
+	Upstream     string            `json:"upstream"`
+	Upstreams    *Upstreams        `json:"upstreams,omitempty"`
+	PreserveHost bool              `json:"preserve_host"`
+	StripPath    bool              `json:"strip_path"`
+	TLS          *UpstreamTLS      `json:"tls,omitempty"`
+	Transport    *Transport        `json:"transport,omitempty"`
+	Retry        *Retry            `json:"retry,omitempty"`
+	Rewrite      *Rewrite          `json:"rewrite,omitempty"`
+}
+
+// Upstreams defines the upstream targets requests are load balanced across.
+// It is an alternative to Upstream for the services running multiple replicas
+type Upstreams struct {
+	Balancing   string       `json:"balancing"`
+	HashOn      string       `json:"hash_on,omitempty"`
+	HashKey     string       `json:"hash_key,omitempty"`
+	Targets     []*Target    `json:"targets"`
+	HealthCheck *HealthCheck `json:"health_check,omitempty"`
+}
+
+// Target defines an upstream target. Weight defaults to 1
+type Target struct {
+	URL    string `json:"url"`
+	Weight int    `json:"weight"`
 }
 
 // RouterDefinition defines the proxy router
 // It is helpful to hold service's proxy specific plugins
 type RouterDefinition struct {
 	*Definition
+	Name            string // name of the service being proxied
 	middlewareFuncs []router.MiddlewareFunc
+	middlewareNames []string
+
+	// hooks of the plugins, run by the register the service is added to
+	onCommit []func()
+	onClose  []func()
 }
 
 // NewDefinition returns new instance of proxy definition initialised with defaults
@@ -24,6 +64,98 @@ func NewDefinition() *Definition {
 	return &Definition{}
 }
 
+// Validate checks if the proxy definition can be registered
+func (d *Definition) Validate() error {
+	if err := d.route("").Validate(); err != nil {
+		return fmt.Errorf("invalid listen_path `%s` [%s]", d.ListenPath, err)
+	}
+
+	if err := d.validateUpstreams(); err != nil {
+		return err
+	}
+
+	if d.Retry != nil {
+		if err := d.Retry.Validate(); err != nil {
+			return err
+		}
+	}
+
+	if d.Rewrite != nil {
+		return d.Rewrite.Validate()
+	}
+	return nil
+}
+
+func (d *Definition) validateUpstreams() error {
+	if d.Upstreams == nil || len(d.Upstreams.Targets) == 0 {
+		if d.Upstream == "" {
+			return errors.New("either upstream or upstreams.targets must be provided")
+		}
+		return validateUpstreamURL(d.Upstream)
+	}
+
+	if d.Upstream != "" {
+		return errors.New("upstream and upstreams.targets can not be used together")
+	}
+	return d.Upstreams.Validate()
+}
+
+// Validate checks the targets and the balancing strategy
+func (u *Upstreams) Validate() error {
+	for _, t := range u.Targets {
+		if err := validateUpstreamURL(t.URL); err != nil {
+			return err
+		}
+		if t.Weight < 0 {
+			return fmt.Errorf("weight of upstream target `%s` can not be negative", t.URL)
+		}
+	}
+
+	switch u.Balancing {
+	case "", RoundRobin, WeightedRoundRobin, LeastConnections, Random:
+	case ConsistentHash:
+		switch u.HashOn {
+		case HashOnIP:
+		case HashOnHeader, HashOnCookie:
+			if u.HashKey == "" {
+				return fmt.Errorf("hash_key is required to hash on %s", u.HashOn)
+			}
+		default:
+			return fmt.Errorf("unsupported hash_on `%s`, should be of (header/cookie/ip)", u.HashOn)
+		}
+	default:
+		return fmt.Errorf("unsupported balancing strategy `%s`", u.Balancing)
+	}
+
+	if u.HealthCheck != nil && u.HealthCheck.Active != nil && u.HealthCheck.Active.Path == "" {
+		return errors.New("path is required for active health checks")
+	}
+
+	return nil
+}
+
+// route returns the router route of the service
+func (d *Definition) route(service string) *router.Route {
+	return &router.Route{
+		Service: service,
+		Path:    d.ListenPath,
+		Hosts:   d.Hosts,
+		Methods: d.Methods,
+		Headers: d.Headers,
+	}
+}
+
+func validateUpstreamURL(upstream string) error {
+	target, err := url.Parse(upstream)
+	if err != nil {
+		return fmt.Errorf("invalid upstream `%s` [%s]", upstream, err)
+	}
+	if target.Scheme == "" || target.Host == "" {
+		return fmt.Errorf("invalid upstream `%s`, scheme and host are required", upstream)
+	}
+	return nil
+}
+
 // NewRouterDefinition takes proxy definition and
 // returns a new instance of RouterDefintion
 func NewRouterDefinition(definition *Definition) *RouterDefinition {
@@ -35,9 +167,39 @@ func NewRouterDefinition(definition *Definition) *RouterDefinition {
 // AddMiddleware adds middlewares
 func (rd *RouterDefinition) AddMiddleware(mw router.MiddlewareFunc) {
 	rd.middlewareFuncs = append(rd.middlewareFuncs, mw)
+	rd.middlewareNames = append(rd.middlewareNames, "")
+}
+
+// OnCommit adds a func which is called once the register having the service
+// starts serving requests. Plugins use it to publish their state, so that
+// the state of a register discarded by a failed reload is never used
+func (rd *RouterDefinition) OnCommit(f func()) {
+	rd.onCommit = append(rd.onCommit, f)
+}
+
+// OnClose adds a func which is called once the register having the service
+// is closed. Plugins use it to release the resources they hold, like the
+// background goroutines. It is called even if the service is not added
+func (rd *RouterDefinition) OnClose(f func()) {
+	rd.onClose = append(rd.onClose, f)
+}
+
+// NameMiddlewares names the middlewares which are added since it was last called.
+// Service loader uses it to label middlewares with the plugin which added them
+func (rd *RouterDefinition) NameMiddlewares(name string) {
+	for i := range rd.middlewareNames {
+		if rd.middlewareNames[i] == "" {
+			rd.middlewareNames[i] = name
+		}
+	}
 }
 
 // ListMiddlewareFuncs retuns list of registered middleware functions
 func (rd *RouterDefinition) ListMiddlewareFuncs() []router.MiddlewareFunc {
 	return rd.middlewareFuncs
 }
+
+// ListMiddlewareNames retuns names of registered middleware functions in order
+func (rd *RouterDefinition) ListMiddlewareNames() []string {
+	return rd.middlewareNames
+}
@@ -0,0 +1,224 @@
+package proxy
+
+import (
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/AyushSenapati/guardian/lib/logger"
+)
+
+// defaults of health checks, used when a value is not configured
+const (
+	defaultCheckInterval      = 10 // in second(s)
+	defaultCheckTimeout       = 2  // in second(s)
+	defaultHealthyThreshold   = 2
+	defaultUnhealthyThreshold = 3
+	defaultPassiveThreshold   = 5
+	defaultEjectDuration      = 30 // in second(s)
+)
+
+// HealthCheck defines how health of upstream targets is determined
+type HealthCheck struct {
+	Active  *ActiveHealthCheck  `json:"active,omitempty"`
+	Passive *PassiveHealthCheck `json:"passive,omitempty"`
+}
+
+// ActiveHealthCheck periodically probes the targets. A target is marked
+// unhealthy after UnhealthyThreshold consecutive failed probes and
+// healthy again after HealthyThreshold consecutive successful probes
+type ActiveHealthCheck struct {
+	Path               string `json:"path"`
+	Interval           int    `json:"interval"` // in second(s)
+	Timeout            int    `json:"timeout"`  // in second(s)
+	HealthyThreshold   int    `json:"healthy_threshold"`
+	UnhealthyThreshold int    `json:"unhealthy_threshold"`
+}
+
+// PassiveHealthCheck ejects a target for EjectDuration after UnhealthyThreshold
+// consecutive proxied requests failed with 5xx or connection errors
+type PassiveHealthCheck struct {
+	UnhealthyThreshold int `json:"unhealthy_threshold"`
+	EjectDuration      int `json:"eject_duration"` // in second(s)
+}
+
+// TargetHealth reports the health state of an upstream target
+type TargetHealth struct {
+	URL     string `json:"url"`
+	Healthy bool   `json:"healthy"`
+	Ejected bool   `json:"ejected"`
+	Active  int64  `json:"active_requests"`
+}
+
+// ServiceHealth reports the health state of all the upstream targets of a service
+type ServiceHealth struct {
+	Service string         `json:"service"`
+	Targets []TargetHealth `json:"targets"`
+}
+
+// health holds the health state of a target
+type health struct {
+	unhealthy    int32 // set by active checks, accessed atomically
+	ejectedUntil int64 // unix nano set by passive checks, accessed atomically
+
+	sync.Mutex
+	successes int // consecutive successful probes
+	failures  int // consecutive failed probes
+	errors    int // consecutive failed requests
+}
+
+// available reports if the target can be elected
+func (t *target) available() bool {
+	return atomic.LoadInt32(&t.health.unhealthy) == 0 &&
+		atomic.LoadInt64(&t.health.ejectedUntil) < time.Now().UnixNano()
+}
+
+func (t *target) healthState() TargetHealth {
+	return TargetHealth{
+		URL:     t.url.String(),
+		Healthy: atomic.LoadInt32(&t.health.unhealthy) == 0,
+		Ejected: atomic.LoadInt64(&t.health.ejectedUntil) >= time.Now().UnixNano(),
+		Active:  atomic.LoadInt64(&t.active),
+	}
+}
+
+// recordProbe records result of an active health check probe
+func (t *target) recordProbe(ok bool, conf *ActiveHealthCheck) {
+	t.health.Lock()
+	defer t.health.Unlock()
+
+	if ok {
+		t.health.successes++
+		t.health.failures = 0
+		if t.health.successes == conf.HealthyThreshold &&
+			atomic.CompareAndSwapInt32(&t.health.unhealthy, 1, 0) {
+			logger.Info("upstream target is healthy", "target", t.url)
+		}
+		return
+	}
+
+	t.health.failures++
+	t.health.successes = 0
+	if t.health.failures == conf.UnhealthyThreshold &&
+		atomic.CompareAndSwapInt32(&t.health.unhealthy, 0, 1) {
+		logger.Warn("upstream target is unhealthy", "target", t.url)
+	}
+}
+
+// recordResult records result of a proxied request. It is a no-op
+// unless passive health checking is configured for the target
+func (t *target) recordResult(ok bool) {
+	conf := t.passive
+	if conf == nil {
+		return
+	}
+
+	t.health.Lock()
+	defer t.health.Unlock()
+
+	if ok {
+		t.health.errors = 0
+		return
+	}
+
+	t.health.errors++
+	if t.health.errors >= conf.UnhealthyThreshold {
+		t.health.errors = 0
+		ejectFor := time.Duration(conf.EjectDuration) * time.Second
+		atomic.StoreInt64(&t.health.ejectedUntil, time.Now().Add(ejectFor).UnixNano())
+		logger.Warn("upstream target is ejected", "target", t.url, "duration", ejectFor)
+	}
+}
+
+// healthChecker actively probes the upstream targets of a service
+type healthChecker struct {
+	conf     *ActiveHealthCheck
+	targets  []*target
+	client   *http.Client
+	stopChan chan struct{}
+	stopOnce sync.Once
+}
+
+func newHealthChecker(conf *ActiveHealthCheck, targets []*target, transport http.RoundTripper) *healthChecker {
+	return &healthChecker{
+		conf:    conf,
+		targets: targets,
+		client: &http.Client{
+			Transport: transport,
+			Timeout:   time.Duration(conf.Timeout) * time.Second,
+			// a redirect is considered as a healthy response
+			CheckRedirect: func(*http.Request, []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
+		},
+		stopChan: make(chan struct{}),
+	}
+}
+
+func (hc *healthChecker) start() {
+	ticker := time.NewTicker(time.Duration(hc.conf.Interval) * time.Second)
+
+	go func() {
+		defer ticker.Stop()
+		for {
+			select {
+			case <-hc.stopChan:
+				return
+			case <-ticker.C:
+				for _, t := range hc.targets {
+					t.recordProbe(hc.probe(t), hc.conf)
+				}
+			}
+		}
+	}()
+}
+
+func (hc *healthChecker) stop() {
+	hc.stopOnce.Do(func() { close(hc.stopChan) })
+}
+
+func (hc *healthChecker) probe(t *target) bool {
+	u := *t.url
+	u.Path = strings.TrimSuffix(u.Path, "/") + "/" + strings.TrimPrefix(hc.conf.Path, "/")
+
+	resp, err := hc.client.Get(u.String())
+	if err != nil {
+		logger.Debug("health check failed", "target", t.url, "error", err)
+		return false
+	}
+	resp.Body.Close()
+
+	return resp.StatusCode >= http.StatusOK && resp.StatusCode < http.StatusBadRequest
+}
+
+// withDefaults returns a copy of the health check config with defaults
+// filled in for the values which are not configured
+func (hc *HealthCheck) withDefaults() *HealthCheck {
+	conf := &HealthCheck{}
+
+	if hc.Active != nil {
+		active := *hc.Active
+		setDefault(&active.Interval, defaultCheckInterval)
+		setDefault(&active.Timeout, defaultCheckTimeout)
+		setDefault(&active.HealthyThreshold, defaultHealthyThreshold)
+		setDefault(&active.UnhealthyThreshold, defaultUnhealthyThreshold)
+		conf.Active = &active
+	}
+
+	if hc.Passive != nil {
+		passive := *hc.Passive
+		setDefault(&passive.UnhealthyThreshold, defaultPassiveThreshold)
+		setDefault(&passive.EjectDuration, defaultEjectDuration)
+		conf.Passive = &passive
+	}
+
+	return conf
+}
+
+func setDefault(value *int, def int) {
+	if *value <= 0 {
+		*value = def
+	}
+}
@@ -1,46 +1,173 @@
 package proxy
 
 import (
-	"log"
+	"fmt"
 	"net/http"
-	"regexp"
 
+	"github.com/AyushSenapati/guardian/lib/logger"
 	"github.com/AyushSenapati/guardian/lib/router"
 )
 
-var matcher = regexp.MustCompile(`(\/\*(.+)?)`)
-
 // Register is the register of the proxy, which manages the choosen router
 type Register struct {
-	Router router.Router
+	Router   router.Router
+	routes   []RouteInfo
+	targets  map[string][]*target
+	checkers []*healthChecker
+
+	// transports are dedicated to the registered services
+	transports []*http.Transport
+
+	// hooks of the plugins of the services
+	onCommit []func()
+	onClose  []func()
+}
+
+// RouteInfo describes a route registered in the proxy register
+type RouteInfo struct {
+	Service     string            `json:"service"`
+	Hosts       []string          `json:"hosts,omitempty"`
+	ListenPath  string            `json:"listen_path"`
+	Methods     []string          `json:"methods,omitempty"`
+	Headers     map[string]string `json:"headers,omitempty"`
+	Upstreams   []string          `json:"upstreams"`
+	Middlewares []string          `json:"middlewares"`
+
+	route *router.Route
 }
 
 // NewRegister returns an instance of proxy register initialised with provided router
 func NewRegister(rtr router.Router) *Register {
-	return &Register{Router: rtr}
+	return &Register{Router: rtr, targets: make(map[string][]*target)}
 }
 
 // Add registers the provided proxy definition in the register
-func (r *Register) Add(def *RouterDefinition) {
-	reverseProxy := newRevesedProxy(def.Definition)
-	if reverseProxy.Transport == nil {
-		reverseProxy.Transport = http.DefaultTransport
+func (r *Register) Add(def *RouterDefinition) error {
+	// resources of the plugins are released with the register,
+	// even if the service can not be added
+	r.Discard(def)
+
+	route := def.route(def.Name)
+	if err := route.Validate(); err != nil {
+		return fmt.Errorf("`%s` is not a valid listen_path [%s]", def.ListenPath, err)
+	}
+
+	for _, registered := range r.routes {
+		if registered.route.Conflicts(route) {
+			return fmt.Errorf(
+				"listen_path `%s` is already registered for the same hosts by service `%s`",
+				def.ListenPath, registered.Service,
+			)
+		}
+	}
+
+	targets, err := newTargets(def.Definition)
+	if err != nil {
+		return err
+	}
+	balancer, err := newBalancer(def.Definition, targets)
+	if err != nil {
+		return err
+	}
+
+	rw, err := newRewriter(def.Definition)
+	if err != nil {
+		return err
+	}
+
+	reverseProxy := newRevesedProxy(def.Definition, rw)
+	transport, err := newTransport(def.Definition)
+	if err != nil {
+		return err
+	}
+	reverseProxy.Transport = transport
+	if def.Retry != nil {
+		reverseProxy.Transport = newRetryTransport(def.Definition, balancer, len(targets), transport)
+	}
+	r.transports = append(r.transports, transport)
+
+	if def.Upstreams != nil && def.Upstreams.HealthCheck != nil {
+		if active := def.Upstreams.HealthCheck.withDefaults().Active; active != nil {
+			checker := newHealthChecker(active, targets, transport)
+			checker.start()
+			r.checkers = append(r.checkers, checker)
+		}
+	}
+
+	r.doRegister(route, newUpstreamHandler(balancer, reverseProxy), def.ListMiddlewareFuncs())
+	r.targets[def.Name] = targets
+	r.onCommit = append(r.onCommit, def.onCommit...)
+	logger.Debug(
+		"route registered", "service", def.Name, "path", def.ListenPath,
+		"middlewares", len(def.ListMiddlewareFuncs()),
+	)
+
+	upstreams := make([]string, 0, len(targets))
+	for _, t := range targets {
+		upstreams = append(upstreams, t.url.String())
+	}
+	r.routes = append(r.routes, RouteInfo{
+		Service:     def.Name,
+		Hosts:       def.Hosts,
+		ListenPath:  def.ListenPath,
+		Methods:     def.Methods,
+		Headers:     def.Headers,
+		Upstreams:   upstreams,
+		Middlewares: def.ListMiddlewareNames(),
+		route:       route,
+	})
+
+	return nil
+}
+
+// Health returns health state of upstream targets of the registered services
+func (r *Register) Health() []ServiceHealth {
+	services := make([]ServiceHealth, 0, len(r.routes))
+	for _, route := range r.routes {
+		sh := ServiceHealth{Service: route.Service}
+		for _, t := range r.targets[route.Service] {
+			sh.Targets = append(sh.Targets, t.healthState())
+		}
+		services = append(services, sh)
+	}
+	return services
+}
+
+// Discard takes the close hooks of the definition which is not going to be
+// added, so that the resources its plugins hold are released with the register
+func (r *Register) Discard(def *RouterDefinition) {
+	r.onClose = append(r.onClose, def.onClose...)
+}
+
+// Commit runs the commit hooks of the plugins of the registered services.
+// It must be called once the register starts serving requests
+func (r *Register) Commit() {
+	for _, f := range r.onCommit {
+		f()
 	}
+}
 
-	if matcher.MatchString(def.ListenPath) {
-		r.doRegister(
-			matcher.ReplaceAllString(def.ListenPath, ""),
-			reverseProxy.ServeHTTP,
-			def.ListMiddlewareFuncs(),
-		)
-	} else {
-		log.Println("warn: not a valid listen_path... skiping")
+// Close stops the background health checks of the registered services,
+// closes the idle upstream connections and runs the close hooks of the
+// plugins. It must be called once the register is not used anymore
+func (r *Register) Close() {
+	for _, checker := range r.checkers {
+		checker.stop()
 	}
+	for _, transport := range r.transports {
+		transport.CloseIdleConnections()
+	}
+	for _, f := range r.onClose {
+		f()
+	}
+}
+
+// Routes returns the routes registered in the register
+func (r *Register) Routes() []RouteInfo {
+	return r.routes
 }
 
 func (r *Register) doRegister(
-	listenPath string, handler http.HandlerFunc, mwfs []router.MiddlewareFunc) {
-	// listenPath = listenPath + "/{[A-Za-z0-9_@./#&+-]+}"
-	listenPath += "/"
-	r.Router.RegisterPath(listenPath, handler, mwfs)
+	route *router.Route, handler http.HandlerFunc, mwfs []router.MiddlewareFunc) {
+	r.Router.RegisterRoute(route, handler, mwfs)
 }
@@ -0,0 +1,418 @@
+package proxy
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/AyushSenapati/guardian/lib/accesslog"
+	"github.com/AyushSenapati/guardian/lib/logger"
+	"github.com/AyushSenapati/guardian/lib/metrics"
+	"github.com/AyushSenapati/guardian/lib/router"
+)
+
+// kinds of upstream errors requests can be retried on
+const (
+	RetryOnConnectFailure = "connect-failure"
+	RetryOnTimeout        = "timeout"
+	RetryOnReset          = "reset"
+)
+
+// defaults of retry policy, used when a value is not configured
+const (
+	defaultRetryAttempts       = 3
+	defaultRetryBaseDelay      = 25   // in millisecond(s)
+	defaultRetryMaxDelay       = 1000 // in millisecond(s)
+	defaultRetryBudget         = 20   // in percent of requests
+	defaultMinRetriesPerSecond = 3
+	defaultRetryMaxBodySize    = 64 << 10 // in byte(s)
+
+	// retry budget is calculated on the traffic of last budgetWindow second(s)
+	budgetWindow = 10
+)
+
+var (
+	idempotentMethods = []string{
+		http.MethodGet, http.MethodHead, http.MethodOptions,
+		http.MethodTrace, http.MethodPut, http.MethodDelete,
+	}
+	defaultRetryStatusCodes = []int{
+		http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout,
+	}
+	retryErrors = []string{RetryOnConnectFailure, RetryOnTimeout, RetryOnReset}
+)
+
+// Retry defines the policy of retrying failed upstream requests.
+// Every retry is directed to a newly elected target if the service
+// has more than one. Retries are limited by the budget, which is the
+// percentage of requests of last 10 seconds allowed to be retried
+type Retry struct {
+	// Attempts is the max number of attempts including the first one
+	Attempts int `json:"attempts"`
+	// Methods can be retried, defaults to the idempotent methods
+	Methods []string `json:"methods,omitempty"`
+	// StatusCodes of upstream responses to be retried, defaults to 502, 503 and 504
+	StatusCodes []int `json:"status_codes,omitempty"`
+	// Errors to be retried (connect-failure/timeout/reset), defaults to all of them
+	Errors    []string `json:"errors,omitempty"`
+	BaseDelay int      `json:"base_delay"` // in millisecond(s)
+	MaxDelay  int      `json:"max_delay"`  // in millisecond(s)
+	Budget    float64  `json:"budget"`     // in percent
+	// MinRetriesPerSecond are allowed regardless of the budget,
+	// so that services with low traffic can be retried as well
+	MinRetriesPerSecond int `json:"min_retries_per_second"`
+	// requests with larger body are not retried as the body can not be replayed
+	MaxBodySize int64 `json:"max_body_size"` // in byte(s)
+}
+
+// Validate checks if the retry policy is valid
+func (r *Retry) Validate() error {
+	if r.Attempts < 0 || r.BaseDelay < 0 || r.MaxDelay < 0 || r.MinRetriesPerSecond < 0 || r.MaxBodySize < 0 {
+		return errors.New("retry values can not be negative")
+	}
+	if r.Budget < 0 || r.Budget > 100 {
+		return fmt.Errorf("retry budget `%v` must be in between 0 and 100", r.Budget)
+	}
+	for _, e := range r.Errors {
+		if !containsString(retryErrors, e) {
+			return fmt.Errorf(
+				"unsupported retry error `%s`, should be of (%s)", e, strings.Join(retryErrors, "/"))
+		}
+	}
+	for _, code := range r.StatusCodes {
+		if code < 100 || code > 599 {
+			return fmt.Errorf("invalid retry status code `%d`", code)
+		}
+	}
+	return nil
+}
+
+// withDefaults returns a copy of the retry policy with defaults
+// filled in for the values which are not configured
+func (r *Retry) withDefaults() *Retry {
+	conf := *r
+	setDefault(&conf.Attempts, defaultRetryAttempts)
+	setDefault(&conf.BaseDelay, defaultRetryBaseDelay)
+	setDefault(&conf.MaxDelay, defaultRetryMaxDelay)
+	setDefault(&conf.MinRetriesPerSecond, defaultMinRetriesPerSecond)
+	if conf.Budget == 0 {
+		conf.Budget = defaultRetryBudget
+	}
+	if conf.MaxBodySize == 0 {
+		conf.MaxBodySize = defaultRetryMaxBodySize
+	}
+	if len(conf.Methods) == 0 {
+		conf.Methods = idempotentMethods
+	}
+	if len(conf.StatusCodes) == 0 {
+		conf.StatusCodes = defaultRetryStatusCodes
+	}
+	if len(conf.Errors) == 0 {
+		conf.Errors = retryErrors
+	}
+	return &conf
+}
+
+// attemptError is the error of the last attempt, which
+// lets the proxy error handler blame the target it was sent to
+type attemptError struct {
+	target *target
+	err    error
+}
+
+func (e *attemptError) Error() string { return e.err.Error() }
+
+func (e *attemptError) Unwrap() error { return e.err }
+
+// retryTransport retries the failed upstream requests as per the retry policy
+type retryTransport struct {
+	conf       *Retry
+	definition *Definition
+	balancer   balancer
+	targets    int
+	transport  http.RoundTripper
+	budget     *retryBudget
+}
+
+func newRetryTransport(
+	def *Definition, b balancer, targets int, transport http.RoundTripper) *retryTransport {
+	conf := def.Retry.withDefaults()
+	return &retryTransport{
+		conf:       conf,
+		definition: def,
+		balancer:   b,
+		targets:    targets,
+		transport:  transport,
+		budget:     &retryBudget{percent: conf.Budget, minPerSecond: conf.MinRetriesPerSecond},
+	}
+}
+
+func (rt *retryTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	rt.budget.request()
+
+	if !containsString(rt.conf.Methods, req.Method) {
+		return rt.transport.RoundTrip(req)
+	}
+
+	// body is buffered so that it can be replayed on retries
+	var body []byte
+	if req.Body != nil && req.Body != http.NoBody {
+		buf, err := ioutil.ReadAll(io.LimitReader(req.Body, rt.conf.MaxBodySize+1))
+		if err != nil {
+			return nil, err
+		}
+		if int64(len(buf)) > rt.conf.MaxBodySize {
+			req.Body = readCloser{io.MultiReader(bytes.NewReader(buf), req.Body), req.Body}
+			return rt.transport.RoundTrip(req)
+		}
+		body = buf
+	}
+
+	t := targetFromCtx(req.Context())
+	tried := []*target{t}
+	attemptReq := rt.attempt(req, t, body)
+
+	for attempt := 1; ; attempt++ {
+		resp, err := rt.transport.RoundTrip(attemptReq)
+		if !rt.shouldRetry(attemptReq, attempt, resp, err) {
+			if err != nil {
+				return nil, &attemptError{target: t, err: err}
+			}
+			return resp, nil
+		}
+
+		// if there is no target to retry, the attempt is the last one
+		// and the response of the upstream is returned as it is
+		next, electErr := rt.elect(req, tried)
+		if electErr != nil {
+			if err != nil {
+				return nil, &attemptError{target: t, err: err}
+			}
+			return resp, nil
+		}
+
+		// last attempt is left to the reverse proxy to be accounted
+		// for, failure of the intermediate attempts are accounted here
+		service := router.RouteFromCtx(req.Context()).Service
+		t.recordResult(false)
+		if err != nil {
+			metrics.UpstreamErrors.With(service, t.url.String()).Inc()
+		} else {
+			io.Copy(ioutil.Discard, resp.Body)
+			resp.Body.Close()
+		}
+		metrics.UpstreamRetries.With(service).Inc()
+
+		if !rt.sleep(req.Context(), attempt) {
+			return nil, &attemptError{target: t, err: req.Context().Err()}
+		}
+
+		logger.FromCtx(req.Context()).Debug(
+			"retrying upstream request", "attempt", attempt+1,
+			"failed_target", t.url, "target", next.url,
+		)
+
+		t = next
+		tried = append(tried, t)
+		attemptReq = rt.attempt(req, t, body)
+	}
+}
+
+// shouldRetry reports if the attempt failed and it can be retried
+func (rt *retryTransport) shouldRetry(req *http.Request, attempt int, resp *http.Response, err error) bool {
+	if attempt >= rt.conf.Attempts || req.Context().Err() != nil {
+		return false
+	}
+
+	if err != nil {
+		if !rt.retryableError(err) {
+			return false
+		}
+	} else if !containsInt(rt.conf.StatusCodes, resp.StatusCode) {
+		return false
+	}
+
+	return rt.budget.withdraw()
+}
+
+func (rt *retryTransport) retryableError(err error) bool {
+	var opErr *net.OpError
+	if containsString(rt.conf.Errors, RetryOnConnectFailure) &&
+		errors.As(err, &opErr) && opErr.Op == "dial" {
+		return true
+	}
+
+	var netErr net.Error
+	if containsString(rt.conf.Errors, RetryOnTimeout) &&
+		errors.As(err, &netErr) && netErr.Timeout() {
+		return true
+	}
+
+	return containsString(rt.conf.Errors, RetryOnReset) &&
+		(errors.Is(err, syscall.ECONNRESET) || errors.Is(err, io.EOF) ||
+			errors.Is(err, io.ErrUnexpectedEOF))
+}
+
+// it waits before the next attempt using exponential backoff with
+// full jitter. It returns false if the request is canceled meanwhile
+func (rt *retryTransport) sleep(ctx context.Context, attempt int) bool {
+	backoff := rt.conf.BaseDelay << uint(attempt-1)
+	if backoff <= 0 || backoff > rt.conf.MaxDelay {
+		backoff = rt.conf.MaxDelay
+	}
+	timer := time.NewTimer(time.Duration(rand.Intn(backoff+1)) * time.Millisecond)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// it elects the target for the next attempt, preferring the ones not tried yet.
+// Service having a single target retries the same one
+func (rt *retryTransport) elect(req *http.Request, tried []*target) (*target, error) {
+	var t *target
+	var err error
+	for i := 0; i < rt.targets; i++ {
+		if t, err = rt.balancer.elect(req); err != nil {
+			return nil, err
+		}
+		if !containsTarget(tried, t) {
+			break
+		}
+	}
+	return t, nil
+}
+
+// attempt returns the copy of the request directed to the provided target
+func (rt *retryTransport) attempt(req *http.Request, t *target, body []byte) *http.Request {
+	attemptReq := req.WithContext(withTarget(req.Context(), t))
+	if body != nil {
+		attemptReq.Body = ioutil.NopCloser(bytes.NewReader(body))
+	}
+
+	first := targetFromCtx(req.Context())
+	if t == first {
+		return attemptReq
+	}
+
+	u := *req.URL
+	u.Path = joinPath(t.url.Path, strings.TrimPrefix(u.Path, strings.TrimSuffix(first.url.Path, "/")))
+	u.RawPath = ""
+	u.Host = t.url.Host
+	u.Scheme = t.url.Scheme
+	attemptReq.URL = &u
+	if !rt.definition.PreserveHost {
+		attemptReq.Host = t.url.Host
+	}
+
+	// active connections of the first target are tracked by the upstream handler
+	atomic.AddInt64(&t.active, 1)
+	go func() {
+		<-attemptReq.Context().Done()
+		atomic.AddInt64(&t.active, -1)
+	}()
+	accesslog.SetUpstream(req.Context(), t.url.Host)
+
+	return attemptReq
+}
+
+// retryBudget limits the retries to a percentage of the requests
+// served in last budgetWindow second(s)
+type retryBudget struct {
+	percent      float64
+	minPerSecond int
+
+	mu      sync.Mutex
+	buckets [budgetWindow]budgetBucket
+}
+
+type budgetBucket struct {
+	second   int64
+	requests int
+	retries  int
+}
+
+func (b *retryBudget) bucket(now int64) *budgetBucket {
+	bucket := &b.buckets[now%budgetWindow]
+	if bucket.second != now {
+		*bucket = budgetBucket{second: now}
+	}
+	return bucket
+}
+
+// request records a request served
+func (b *retryBudget) request() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.bucket(time.Now().Unix()).requests++
+}
+
+// withdraw reports if a retry is allowed and records it
+func (b *retryBudget) withdraw() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := time.Now().Unix()
+	var requests, retries int
+	for _, bucket := range b.buckets {
+		if bucket.second > now-budgetWindow {
+			requests += bucket.requests
+			retries += bucket.retries
+		}
+	}
+
+	if retries >= b.minPerSecond*budgetWindow &&
+		float64(retries) >= float64(requests)*b.percent/100 {
+		return false
+	}
+	b.bucket(now).retries++
+	return true
+}
+
+// readCloser reads from the reader and closes the closer
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+func containsInt(values []int, value int) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+func containsTarget(targets []*target, t *target) bool {
+	for _, v := range targets {
+		if v == t {
+			return true
+		}
+	}
+	return false
+}
@@ -1,32 +1,101 @@
 package proxy
 
 import (
-	"log"
+	"context"
+	"errors"
 	"net/http"
 	"net/http/httputil"
-	"net/url"
-	"strings"
+	"sync/atomic"
+
+	"github.com/AyushSenapati/guardian/lib/accesslog"
+	"github.com/AyushSenapati/guardian/lib/logger"
+	"github.com/AyushSenapati/guardian/lib/metrics"
+	"github.com/AyushSenapati/guardian/lib/router"
 )
 
-func newRevesedProxy(definition *Definition) *httputil.ReverseProxy {
+type targetCtxKey struct{}
+
+func withTarget(ctx context.Context, t *target) context.Context {
+	return context.WithValue(ctx, targetCtxKey{}, t)
+}
+
+func targetFromCtx(ctx context.Context) *target {
+	t, _ := ctx.Value(targetCtxKey{}).(*target)
+	return t
+}
+
+func newRevesedProxy(definition *Definition, rw *rewriter) *httputil.ReverseProxy {
 	return &httputil.ReverseProxy{
-		Director: createDirector(definition),
+		Director:       createDirector(definition, rw),
+		ModifyResponse: recordResponse,
+		ErrorHandler:   handleProxyError,
+		ErrorLog:       logger.StdLogger(logger.ErrorLevel),
 	}
 }
 
-func createDirector(definition *Definition) func(*http.Request) {
-	return func(req *http.Request) {
-		orgReqURI := req.URL.Path // org req URI for logging
+// it feeds the response status to passive health check of the target
+func recordResponse(resp *http.Response) error {
+	if t := targetFromCtx(resp.Request.Context()); t != nil {
+		t.recordResult(resp.StatusCode < http.StatusInternalServerError)
+	}
+	return nil
+}
+
+// it feeds the failure to passive health check of the target
+// and responds with bad gateway like the default error handler does.
+// Requests canceled by the client are not held against the target
+func handleProxyError(w http.ResponseWriter, r *http.Request, err error) {
+	logger.FromCtx(r.Context()).Error("proxy error", "upstream_url", r.URL, "error", err)
+
+	// error of a retried request belongs to the target of the last attempt
+	t := targetFromCtx(r.Context())
+	var attemptErr *attemptError
+	if errors.As(err, &attemptErr) {
+		t = attemptErr.target
+	}
 
-		target, _ := url.Parse(definition.Upstream)
-		path := target.Path + req.URL.Path
+	if t != nil && r.Context().Err() == nil {
+		t.recordResult(false)
+		metrics.UpstreamErrors.With(
+			router.RouteFromCtx(r.Context()).Service, t.url.String()).Inc()
+	}
+	w.WriteHeader(http.StatusBadGateway)
+}
 
-		if definition.StripPath {
-			listenPath := matcher.ReplaceAllString(definition.ListenPath, "")
-			path = strings.Replace(path, listenPath, "", 1)
+// it elects an upstream target for every request and hands the
+// request over to the reverse proxy, which directs it to the elected target
+func newUpstreamHandler(b balancer, reverseProxy http.Handler) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		t, err := b.elect(r)
+		if err != nil {
+			logger.FromCtx(r.Context()).Error("could not elect upstream target", "error", err)
+			http.Error(w, http.StatusText(http.StatusServiceUnavailable), http.StatusServiceUnavailable)
+			return
 		}
 
-		req.URL.Path = path
+		atomic.AddInt64(&t.active, 1)
+		defer atomic.AddInt64(&t.active, -1)
+
+		accesslog.SetUpstream(r.Context(), t.url.Host)
+
+		inFlight := metrics.RequestsInFlight.With(router.RouteFromCtx(r.Context()).Service)
+		inFlight.Inc()
+		defer inFlight.Dec()
+
+		reverseProxy.ServeHTTP(w, r.WithContext(withTarget(r.Context(), t)))
+	}
+}
+
+func createDirector(definition *Definition, rw *rewriter) func(*http.Request) {
+	return func(req *http.Request) {
+		orgReqURI := req.URL.Path // org req URI for logging
+
+		target := targetFromCtx(req.Context()).url
+		params := router.ParamsFromCtx(req.Context())
+
+		path, query := rw.rewritePath(req.URL.Path, params)
+		req.URL.Path = joinPath(target.Path, path)
+		req.URL.RawQuery = rw.rewriteQuery(req.URL.RawQuery, query, params)
 		req.URL.Host = target.Host
 		req.URL.Scheme = target.Scheme
 
@@ -36,15 +105,9 @@ func createDirector(definition *Definition) func(*http.Request) {
 			req.Host = target.Host
 		}
 
-		logStruct := struct {
-			OriginalReqURI string
-			UpstreamHost   string
-			UpstreamURI    string
-		}{
-			OriginalReqURI: orgReqURI,
-			UpstreamHost:   req.URL.Host,
-			UpstreamURI:    req.URL.Path,
-		}
-		log.Printf("%+v", logStruct)
+		logger.FromCtx(req.Context()).Debug(
+			"proxying request", "path", orgReqURI,
+			"upstream_host", req.URL.Host, "upstream_path", req.URL.Path,
+		)
 	}
 }
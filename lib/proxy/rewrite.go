@@ -0,0 +1,240 @@
+package proxy
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"github.com/AyushSenapati/guardian/lib/router"
+)
+
+// supported rewrite modes
+const (
+	// RewriteAppend appends the rewritten request path to the target path
+	RewriteAppend = "append"
+	// RewriteFixed proxies all the requests to the fixed path
+	RewriteFixed = "fixed"
+)
+
+// paramRef matches the references to the listen path params like {id}
+var paramRef = regexp.MustCompile(`\{([A-Za-z_][A-Za-z0-9_]*)\}`)
+
+// Rewrite defines how the request path and query are rewritten before
+// the request is proxied. In append mode the first rule matching the
+// request path rewrites it. If none of them matches, the path is stripped
+// if strip_path is set. In fixed mode requests are proxied to Path, which
+// can refer to the named params of the listen path like /users/{id}
+type Rewrite struct {
+	Mode  string         `json:"mode"`
+	Path  string         `json:"path,omitempty"`
+	Rules []*RewriteRule `json:"rules,omitempty"`
+	Query *QueryRewrite  `json:"query,omitempty"`
+}
+
+// RewriteRule rewrites the paths matching the regex Match to Replace,
+// which can refer to the capture groups like $1 or ${name}.
+// Match is matched against the whole path. Query string found in
+// the rewritten path is added to the query of the request
+type RewriteRule struct {
+	Match   string `json:"match"`
+	Replace string `json:"replace"`
+}
+
+// QueryRewrite defines the changes to the query params. They are applied
+// in the order remove, rename, set and add. Values of set and add can refer
+// to the named params of the listen path like {id}. Params which values
+// resolve to empty are not set
+type QueryRewrite struct {
+	Remove []string          `json:"remove,omitempty"`
+	Rename map[string]string `json:"rename,omitempty"`
+	Set    map[string]string `json:"set,omitempty"`
+	Add    map[string]string `json:"add,omitempty"`
+}
+
+// Validate checks if the rewrite config is valid
+func (rw *Rewrite) Validate() error {
+	switch rw.Mode {
+	case "", RewriteAppend:
+		if rw.Path != "" {
+			return errors.New("rewrite path can only be used in fixed mode")
+		}
+	case RewriteFixed:
+		if rw.Path == "" {
+			return errors.New("rewrite path is required in fixed mode")
+		}
+		if len(rw.Rules) > 0 {
+			return errors.New("rewrite rules can not be used in fixed mode")
+		}
+	default:
+		return fmt.Errorf("unsupported rewrite mode `%s`, should be of (append/fixed)", rw.Mode)
+	}
+
+	for _, rule := range rw.Rules {
+		if _, err := compileRule(rule.Match); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func compileRule(match string) (*regexp.Regexp, error) {
+	re, err := regexp.Compile("^(?:" + match + ")$")
+	if err != nil {
+		return nil, fmt.Errorf("invalid rewrite rule `%s` [%s]", match, err)
+	}
+	return re, nil
+}
+
+// rewriter rewrites the path and query of the requests of a service
+type rewriter struct {
+	stripPath bool
+	// listenRe is the regex of the regex listen paths, used to strip them
+	listenRe  *regexp.Regexp
+	fixedPath string
+	rules     []rewriteRule
+	query     *QueryRewrite
+}
+
+type rewriteRule struct {
+	re      *regexp.Regexp
+	replace string
+}
+
+func newRewriter(def *Definition) (*rewriter, error) {
+	rw := &rewriter{stripPath: def.StripPath}
+	if def.StripPath && strings.HasPrefix(def.ListenPath, "~") {
+		re, err := regexp.Compile(def.ListenPath[1:])
+		if err != nil {
+			return nil, fmt.Errorf("invalid listen_path `%s` [%s]", def.ListenPath, err)
+		}
+		rw.listenRe = re
+	}
+	if def.Rewrite == nil {
+		return rw, nil
+	}
+
+	if def.Rewrite.Mode == RewriteFixed {
+		rw.fixedPath = def.Rewrite.Path
+	}
+	for _, rule := range def.Rewrite.Rules {
+		re, err := compileRule(rule.Match)
+		if err != nil {
+			return nil, err
+		}
+		rw.rules = append(rw.rules, rewriteRule{re: re, replace: rule.Replace})
+	}
+	rw.query = def.Rewrite.Query
+	return rw, nil
+}
+
+// rewritePath returns the path to be appended to the target path,
+// and the query string the rewrite rule adds if any
+func (rw *rewriter) rewritePath(path string, params router.Params) (string, string) {
+	if rw.fixedPath != "" {
+		return expandParams(rw.fixedPath, params), ""
+	}
+
+	for _, rule := range rw.rules {
+		m := rule.re.FindStringSubmatchIndex(path)
+		if m == nil {
+			continue
+		}
+		rewritten := string(rule.re.ExpandString(nil, rule.replace, path, m))
+		if i := strings.IndexByte(rewritten, '?'); i >= 0 {
+			return rewritten[:i], rewritten[i+1:]
+		}
+		return rewritten, ""
+	}
+
+	if rw.stripPath {
+		return rw.strip(path, params), ""
+	}
+	return path, ""
+}
+
+// strip removes the part of the path matched by the listen path
+func (rw *rewriter) strip(path string, params router.Params) string {
+	// stripping the listen path having a wildcard leaves
+	// the part of the path matched by the wildcard
+	if rest, found := params[router.WildcardParam]; found {
+		return rest
+	}
+
+	// regex listen path is stripped only if it matches a prefix of the path
+	if rw.listenRe != nil {
+		if m := rw.listenRe.FindStringIndex(path); m != nil && m[0] == 0 {
+			return path[m[1]:]
+		}
+		return path
+	}
+
+	// exact listen paths and the ones having params match the whole path
+	return ""
+}
+
+// rewriteQuery returns the rewritten raw query. The query is
+// left as it is, if there is nothing to be changed
+func (rw *rewriter) rewriteQuery(rawQuery, extra string, params router.Params) string {
+	if rw.query == nil && extra == "" {
+		return rawQuery
+	}
+
+	query, _ := url.ParseQuery(rawQuery)
+	if extraQuery, err := url.ParseQuery(extra); err == nil {
+		for k, values := range extraQuery {
+			query[k] = append(query[k], values...)
+		}
+	}
+
+	if q := rw.query; q != nil {
+		for _, k := range q.Remove {
+			query.Del(k)
+		}
+		for from, to := range q.Rename {
+			if values, found := query[from]; found {
+				query.Del(from)
+				query[to] = append(query[to], values...)
+			}
+		}
+		for k, v := range q.Set {
+			if v = expandParams(v, params); v != "" {
+				query.Set(k, v)
+			}
+		}
+		for k, v := range q.Add {
+			if v = expandParams(v, params); v != "" {
+				query.Add(k, v)
+			}
+		}
+	}
+	return query.Encode()
+}
+
+// expandParams replaces the references to the params with their values
+func expandParams(s string, params router.Params) string {
+	return paramRef.ReplaceAllStringFunc(s, func(ref string) string {
+		return params[ref[1:len(ref)-1]]
+	})
+}
+
+// joinPath joins the target path and request path with a single slash
+func joinPath(targetPath, path string) string {
+	if path == "" {
+		if targetPath == "" {
+			return "/"
+		}
+		return targetPath
+	}
+
+	targetSlash := strings.HasSuffix(targetPath, "/")
+	pathSlash := strings.HasPrefix(path, "/")
+	switch {
+	case targetSlash && pathSlash:
+		return targetPath + path[1:]
+	case !targetSlash && !pathSlash:
+		return targetPath + "/" + path
+	}
+	return targetPath + path
+}
@@ -0,0 +1,268 @@
+package proxy
+
+import (
+	"testing"
+
+	"github.com/AyushSenapati/guardian/lib/router"
+)
+
+func TestRewritePath(t *testing.T) {
+	tests := []struct {
+		name      string
+		def       *Definition
+		path      string
+		params    router.Params
+		wantPath  string
+		wantQuery string
+	}{
+		{
+			name:     "no rewrite",
+			def:      &Definition{ListenPath: "/users/*"},
+			path:     "/users/1",
+			params:   router.Params{router.WildcardParam: "/1"},
+			wantPath: "/users/1",
+		},
+		{
+			name: "numbered capture groups",
+			def: &Definition{ListenPath: "/*", Rewrite: &Rewrite{Rules: []*RewriteRule{
+				{Match: `/v([0-9]+)/users/(.*)`, Replace: "/users/$2/v$1"},
+			}}},
+			path:     "/v2/users/1",
+			wantPath: "/users/1/v2",
+		},
+		{
+			name: "named capture groups",
+			def: &Definition{ListenPath: "/*", Rewrite: &Rewrite{Rules: []*RewriteRule{
+				{Match: `/old/(?P<rest>.*)`, Replace: "/new/${rest}"},
+			}}},
+			path:     "/old/a/b",
+			wantPath: "/new/a/b",
+		},
+		{
+			name: "rule is matched against the whole path",
+			def: &Definition{ListenPath: "/*", Rewrite: &Rewrite{Rules: []*RewriteRule{
+				{Match: `/users`, Replace: "/accounts"},
+			}}},
+			path:     "/api/users/1",
+			wantPath: "/api/users/1",
+		},
+		{
+			name: "first matching rule wins",
+			def: &Definition{ListenPath: "/*", Rewrite: &Rewrite{Rules: []*RewriteRule{
+				{Match: `/a/.*`, Replace: "/first"},
+				{Match: `/a/b`, Replace: "/second"},
+			}}},
+			path:     "/a/b",
+			wantPath: "/first",
+		},
+		{
+			name: "query of the rewritten path",
+			def: &Definition{ListenPath: "/*", Rewrite: &Rewrite{Rules: []*RewriteRule{
+				{Match: `/users/([0-9]+)`, Replace: "/users?id=$1"},
+			}}},
+			path:      "/users/7",
+			wantPath:  "/users",
+			wantQuery: "id=7",
+		},
+		{
+			name:     "fixed mode",
+			def:      &Definition{ListenPath: "/users/{id}", Rewrite: &Rewrite{Mode: RewriteFixed, Path: "/api/user/{id}/profile"}},
+			path:     "/users/7",
+			params:   router.Params{"id": "7"},
+			wantPath: "/api/user/7/profile",
+		},
+		{
+			name:     "strip_path of wildcard listen path",
+			def:      &Definition{ListenPath: "/users/*", StripPath: true},
+			path:     "/users/1/orders",
+			params:   router.Params{router.WildcardParam: "/1/orders"},
+			wantPath: "/1/orders",
+		},
+		{
+			name:     "strip_path of exact listen path",
+			def:      &Definition{ListenPath: "/users", StripPath: true},
+			path:     "/users",
+			wantPath: "",
+		},
+		{
+			name:     "strip_path of listen path having params",
+			def:      &Definition{ListenPath: "/users/{id}", StripPath: true},
+			path:     "/users/7",
+			params:   router.Params{"id": "7"},
+			wantPath: "",
+		},
+		{
+			name:     "strip_path of regex listen path",
+			def:      &Definition{ListenPath: `~^/v[0-9]+`, StripPath: true},
+			path:     "/v2/users",
+			params:   router.Params{},
+			wantPath: "/users",
+		},
+		{
+			name:     "strip_path of regex listen path not matching a prefix",
+			def:      &Definition{ListenPath: `~/users`, StripPath: true},
+			path:     "/api/users",
+			params:   router.Params{},
+			wantPath: "/api/users",
+		},
+		{
+			name: "rule takes precedence over strip_path",
+			def: &Definition{ListenPath: "/users/*", StripPath: true, Rewrite: &Rewrite{Rules: []*RewriteRule{
+				{Match: `/users/me`, Replace: "/self"},
+			}}},
+			path:     "/users/me",
+			params:   router.Params{router.WildcardParam: "/me"},
+			wantPath: "/self",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.def.Rewrite != nil {
+				if err := tt.def.Rewrite.Validate(); err != nil {
+					t.Fatalf("invalid rewrite: %s", err)
+				}
+			}
+			rw, err := newRewriter(tt.def)
+			if err != nil {
+				t.Fatalf("could not create rewriter: %s", err)
+			}
+
+			path, query := rw.rewritePath(tt.path, tt.params)
+			if path != tt.wantPath || query != tt.wantQuery {
+				t.Errorf("got path %q query %q, want path %q query %q",
+					path, query, tt.wantPath, tt.wantQuery)
+			}
+		})
+	}
+}
+
+func TestRewriteQuery(t *testing.T) {
+	tests := []struct {
+		name     string
+		query    *QueryRewrite
+		rawQuery string
+		extra    string
+		params   router.Params
+		want     string
+	}{
+		{
+			name:     "no query rewrite",
+			rawQuery: "b=2&a=1",
+			want:     "b=2&a=1",
+		},
+		{
+			name:     "remove",
+			query:    &QueryRewrite{Remove: []string{"debug"}},
+			rawQuery: "a=1&debug=true",
+			want:     "a=1",
+		},
+		{
+			name:     "rename",
+			query:    &QueryRewrite{Rename: map[string]string{"q": "search"}},
+			rawQuery: "q=go&page=2",
+			want:     "page=2&search=go",
+		},
+		{
+			name:     "set replaces the values",
+			query:    &QueryRewrite{Set: map[string]string{"page": "1"}},
+			rawQuery: "page=3&page=4",
+			want:     "page=1",
+		},
+		{
+			name:     "add keeps the values",
+			query:    &QueryRewrite{Add: map[string]string{"tag": "new"}},
+			rawQuery: "tag=old",
+			want:     "tag=old&tag=new",
+		},
+		{
+			name:   "set and add refer to params",
+			query:  &QueryRewrite{Set: map[string]string{"user": "{id}"}, Add: map[string]string{"v": "{version}"}},
+			params: router.Params{"id": "7", "version": "2"},
+			want:   "user=7&v=2",
+		},
+		{
+			name:   "params resolving to empty are not set",
+			query:  &QueryRewrite{Set: map[string]string{"user": "{missing}"}},
+			params: router.Params{},
+			want:   "",
+		},
+		{
+			name: "applied in order remove, rename, set and add",
+			query: &QueryRewrite{
+				Remove: []string{"a"},
+				Rename: map[string]string{"b": "a"},
+				Set:    map[string]string{"a": "set"},
+				Add:    map[string]string{"a": "added"},
+			},
+			rawQuery: "a=1&b=2",
+			want:     "a=set&a=added",
+		},
+		{
+			name:     "query of the rewritten path is added",
+			rawQuery: "a=1",
+			extra:    "id=7",
+			want:     "a=1&id=7",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rw, err := newRewriter(&Definition{ListenPath: "/*", Rewrite: &Rewrite{Query: tt.query}})
+			if err != nil {
+				t.Fatalf("could not create rewriter: %s", err)
+			}
+
+			if got := rw.rewriteQuery(tt.rawQuery, tt.extra, tt.params); got != tt.want {
+				t.Errorf("got query %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRewriteValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		rewrite *Rewrite
+		wantErr bool
+	}{
+		{name: "append mode", rewrite: &Rewrite{Rules: []*RewriteRule{{Match: "/a", Replace: "/b"}}}},
+		{name: "fixed mode", rewrite: &Rewrite{Mode: RewriteFixed, Path: "/a"}},
+		{name: "path in append mode", rewrite: &Rewrite{Path: "/a"}, wantErr: true},
+		{name: "fixed mode without path", rewrite: &Rewrite{Mode: RewriteFixed}, wantErr: true},
+		{
+			name:    "rules in fixed mode",
+			rewrite: &Rewrite{Mode: RewriteFixed, Path: "/a", Rules: []*RewriteRule{{Match: "/a"}}},
+			wantErr: true,
+		},
+		{name: "invalid rule", rewrite: &Rewrite{Rules: []*RewriteRule{{Match: "("}}}, wantErr: true},
+		{name: "unsupported mode", rewrite: &Rewrite{Mode: "prepend"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.rewrite.Validate(); (err != nil) != tt.wantErr {
+				t.Errorf("got error %v, want error %t", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestJoinPath(t *testing.T) {
+	tests := []struct {
+		target, path, want string
+	}{
+		{"", "", "/"},
+		{"/api", "", "/api"},
+		{"/api", "/users", "/api/users"},
+		{"/api/", "/users", "/api/users"},
+		{"/api", "users", "/api/users"},
+		{"", "/users", "/users"},
+	}
+
+	for _, tt := range tests {
+		if got := joinPath(tt.target, tt.path); got != tt.want {
+			t.Errorf("joinPath(%q, %q) = %q, want %q", tt.target, tt.path, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,149 @@
+package proxy
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"time"
+)
+
+// defaults of the upstream transport, same as of http.DefaultTransport
+const (
+	defaultDialTimeout         = 30 // in second(s)
+	defaultKeepAlive           = 30 // in second(s)
+	defaultTLSHandshakeTimeout = 10 // in second(s)
+	defaultIdleConnTimeout     = 90 // in second(s)
+	defaultMaxIdleConns        = 100
+)
+
+// Transport defines how connections to the upstream are made and reused.
+// Timeouts are in second(s), 0 means the default is used
+type Transport struct {
+	DialTimeout           int `json:"dial_timeout"`
+	TLSHandshakeTimeout   int `json:"tls_handshake_timeout"`
+	ResponseHeaderTimeout int `json:"response_header_timeout"`
+	IdleConnTimeout       int `json:"idle_conn_timeout"`
+	// KeepAlive is the TCP keep-alive period, negative value disables it
+	KeepAlive           int `json:"keep_alive"`
+	MaxIdleConns        int `json:"max_idle_conns"`
+	MaxIdleConnsPerHost int `json:"max_idle_conns_per_host"`
+	// MaxConnsPerHost limits the connections to an upstream target, 0 means no limit
+	MaxConnsPerHost int `json:"max_conns_per_host"`
+	// DisableKeepAlives makes a new connection to be used for every request
+	DisableKeepAlives bool `json:"disable_keep_alives"`
+	// HTTP2 lets the transport negotiate HTTP/2 with TLS upstreams. Defaults to true
+	HTTP2 *bool `json:"http2,omitempty"`
+	// ProxyFromEnvironment makes the transport use the proxy set by
+	// HTTP_PROXY, HTTPS_PROXY and NO_PROXY env variables. Defaults to true
+	ProxyFromEnvironment *bool `json:"proxy_from_environment,omitempty"`
+}
+
+// UpstreamTLS defines how the gateway connects to an upstream over TLS
+type UpstreamTLS struct {
+	// CAFile is the PEM bundle the upstream certificate is verified with.
+	// System roots are used if it is blank
+	CAFile string `json:"ca_file"`
+	// CertFile and KeyFile are the client certificate
+	// presented to the upstreams requiring mutual TLS
+	CertFile string `json:"cert_file"`
+	KeyFile  string `json:"key_file"`
+	// ServerName overrides the name the upstream certificate is verified against
+	ServerName         string `json:"server_name"`
+	InsecureSkipVerify bool   `json:"insecure_skip_verify"`
+}
+
+// newTransport returns the transport the reverse proxy of the service uses.
+// Every service gets a dedicated transport, so that a slow service can not
+// exhaust the connections of the others
+func newTransport(def *Definition) (*http.Transport, error) {
+	conf := Transport{}
+	if def.Transport != nil {
+		conf = *def.Transport
+	}
+
+	keepAlive := seconds(conf.KeepAlive, defaultKeepAlive)
+	if conf.KeepAlive < 0 {
+		keepAlive = -1
+	}
+	dialer := &net.Dialer{
+		Timeout:   seconds(conf.DialTimeout, defaultDialTimeout),
+		KeepAlive: keepAlive,
+	}
+
+	transport := &http.Transport{
+		DialContext:           dialer.DialContext,
+		TLSHandshakeTimeout:   seconds(conf.TLSHandshakeTimeout, defaultTLSHandshakeTimeout),
+		ResponseHeaderTimeout: seconds(conf.ResponseHeaderTimeout, 0),
+		IdleConnTimeout:       seconds(conf.IdleConnTimeout, defaultIdleConnTimeout),
+		ExpectContinueTimeout: time.Second,
+		MaxIdleConns:          defaultMaxIdleConns,
+		MaxIdleConnsPerHost:   conf.MaxIdleConnsPerHost,
+		MaxConnsPerHost:       conf.MaxConnsPerHost,
+		DisableKeepAlives:     conf.DisableKeepAlives,
+		ForceAttemptHTTP2:     true,
+	}
+	if conf.MaxIdleConns > 0 {
+		transport.MaxIdleConns = conf.MaxIdleConns
+	}
+	if conf.ProxyFromEnvironment == nil || *conf.ProxyFromEnvironment {
+		transport.Proxy = http.ProxyFromEnvironment
+	}
+	if conf.HTTP2 != nil && !*conf.HTTP2 {
+		// a non nil empty map disables HTTP/2
+		transport.ForceAttemptHTTP2 = false
+		transport.TLSNextProto = make(map[string]func(string, *tls.Conn) http.RoundTripper)
+	}
+
+	if def.TLS != nil {
+		tlsConfig, err := def.TLS.config()
+		if err != nil {
+			return nil, err
+		}
+		transport.TLSClientConfig = tlsConfig
+	}
+
+	return transport, nil
+}
+
+// seconds converts the configured value to duration, using the default if it is not set
+func seconds(value, def int) time.Duration {
+	if value <= 0 {
+		value = def
+	}
+	return time.Duration(value) * time.Second
+}
+
+func (t *UpstreamTLS) config() (*tls.Config, error) {
+	conf := &tls.Config{
+		ServerName:         t.ServerName,
+		InsecureSkipVerify: t.InsecureSkipVerify,
+	}
+
+	if t.CAFile != "" {
+		pem, err := ioutil.ReadFile(t.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("could not read CA file [%s]", err)
+		}
+		conf.RootCAs = x509.NewCertPool()
+		if !conf.RootCAs.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificate found in CA file %s", t.CAFile)
+		}
+	}
+
+	if t.CertFile != "" || t.KeyFile != "" {
+		if t.CertFile == "" || t.KeyFile == "" {
+			return nil, errors.New("both cert_file and key_file are required for client certificate")
+		}
+		cert, err := tls.LoadX509KeyPair(t.CertFile, t.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("could not load client certificate [%s]", err)
+		}
+		conf.Certificates = []tls.Certificate{cert}
+	}
+
+	return conf, nil
+}
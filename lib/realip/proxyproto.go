@@ -0,0 +1,184 @@
+package realip
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// proxyV2Signature starts the binary header of PROXY protocol v2
+var proxyV2Signature = []byte("\r\n\r\n\x00\r\nQUIT\n")
+
+// maximum length of PROXY protocol v1 header, including CRLF
+const proxyV1MaxLen = 107
+
+// Listen returns the listener of the address. Connections from the trusted
+// proxies can start with PROXY protocol header, if it is enabled. The address
+// of the client in the header becomes the remote address of the connection
+func (r *Resolver) Listen(network, address string) (net.Listener, error) {
+	l, err := net.Listen(network, address)
+	if err != nil || !r.proxy {
+		return l, err
+	}
+	return &proxyListener{Listener: l, resolver: r}, nil
+}
+
+type proxyListener struct {
+	net.Listener
+	resolver *Resolver
+}
+
+// Accept returns the connection without reading the header, so that
+// a slow client does not block the connections accepted after it
+func (l *proxyListener) Accept() (net.Conn, error) {
+	conn, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	return &proxyConn{Conn: conn, resolver: l.resolver, r: bufio.NewReader(conn)}, nil
+}
+
+// proxyConn reads the PROXY protocol header on first use
+type proxyConn struct {
+	net.Conn
+	resolver *Resolver
+	r        *bufio.Reader
+
+	once       sync.Once
+	remoteAddr net.Addr
+	err        error
+}
+
+func (c *proxyConn) init() {
+	c.once.Do(func() {
+		c.remoteAddr = c.Conn.RemoteAddr()
+		if peer := parseIP(c.remoteAddr.String()); peer == nil || !c.resolver.trusts(peer) {
+			return
+		}
+
+		c.Conn.SetReadDeadline(time.Now().Add(c.resolver.timeout))
+		defer c.Conn.SetReadDeadline(time.Time{})
+
+		addr, err := readProxyHeader(c.r)
+		if err != nil {
+			c.err = fmt.Errorf("invalid PROXY protocol header from %s [%s]", c.remoteAddr, err)
+			c.Conn.Close()
+			return
+		}
+		if addr != nil {
+			c.remoteAddr = addr
+		}
+	})
+}
+
+func (c *proxyConn) Read(b []byte) (int, error) {
+	c.init()
+	if c.err != nil {
+		return 0, c.err
+	}
+	return c.r.Read(b)
+}
+
+// RemoteAddr returns the address of the client sent in the header
+func (c *proxyConn) RemoteAddr() net.Addr {
+	c.init()
+	return c.remoteAddr
+}
+
+// readProxyHeader reads PROXY protocol header if the connection starts with one.
+// It returns nil address if there is no header, or the header does not carry
+// the address of the client, like health checks of the proxy
+func readProxyHeader(r *bufio.Reader) (net.Addr, error) {
+	start, err := r.Peek(len(proxyV2Signature))
+	if err != nil && len(start) == 0 {
+		if err == io.EOF {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	switch {
+	case bytes.HasPrefix(start, []byte("PROXY ")):
+		return readProxyV1(r)
+	case bytes.Equal(start, proxyV2Signature):
+		return readProxyV2(r)
+	}
+	return nil, nil
+}
+
+// readProxyV1 reads the text header like "PROXY TCP4 192.0.2.1 192.0.2.2 56324 443\r\n"
+func readProxyV1(r *bufio.Reader) (net.Addr, error) {
+	var line []byte
+	for !bytes.HasSuffix(line, []byte("\r\n")) {
+		if len(line) >= proxyV1MaxLen {
+			return nil, errors.New("v1 header is too long")
+		}
+		b, err := r.ReadByte()
+		if err != nil {
+			return nil, err
+		}
+		line = append(line, b)
+	}
+
+	fields := strings.Fields(string(line))
+	if len(fields) >= 2 && fields[1] == "UNKNOWN" {
+		return nil, nil
+	}
+	if len(fields) != 6 || (fields[1] != "TCP4" && fields[1] != "TCP6") {
+		return nil, fmt.Errorf("malformed v1 header `%s`", strings.TrimSpace(string(line)))
+	}
+
+	ip := net.ParseIP(fields[2])
+	port, err := strconv.Atoi(fields[4])
+	if ip == nil || err != nil || port < 0 || port > 65535 {
+		return nil, fmt.Errorf("malformed v1 header `%s`", strings.TrimSpace(string(line)))
+	}
+	return &net.TCPAddr{IP: ip, Port: port}, nil
+}
+
+// readProxyV2 reads the binary header
+func readProxyV2(r *bufio.Reader) (net.Addr, error) {
+	header := make([]byte, 16)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return nil, err
+	}
+	if header[12]>>4 != 2 {
+		return nil, fmt.Errorf("unsupported version `%d`", header[12]>>4)
+	}
+
+	body := make([]byte, binary.BigEndian.Uint16(header[14:16]))
+	if _, err := io.ReadFull(r, body); err != nil {
+		return nil, err
+	}
+
+	// LOCAL command is sent by the proxy on its own behalf
+	if header[12]&0x0f == 0 {
+		return nil, nil
+	}
+	if header[12]&0x0f != 1 {
+		return nil, fmt.Errorf("unsupported command `%d`", header[12]&0x0f)
+	}
+
+	switch header[13] >> 4 {
+	case 1: // IPv4
+		if len(body) < 12 {
+			return nil, errors.New("short v2 IPv4 address block")
+		}
+		return &net.TCPAddr{IP: net.IP(body[0:4]), Port: int(binary.BigEndian.Uint16(body[8:10]))}, nil
+	case 2: // IPv6
+		if len(body) < 36 {
+			return nil, errors.New("short v2 IPv6 address block")
+		}
+		return &net.TCPAddr{IP: net.IP(body[0:16]), Port: int(binary.BigEndian.Uint16(body[32:34]))}, nil
+	}
+	// unix sockets and unspecified families do not carry an IP
+	return nil, nil
+}
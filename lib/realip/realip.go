@@ -0,0 +1,218 @@
+package realip
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// supported headers
+const (
+	HeaderForwarded     = "Forwarded"
+	HeaderXForwardedFor = "X-Forwarded-For"
+	HeaderXRealIP       = "X-Real-IP"
+)
+
+var defaultHeaders = []string{HeaderForwarded, HeaderXForwardedFor, HeaderXRealIP}
+
+// Config defines how the IP of the client is resolved. Headers carrying
+// the client IP are honoured only if the request comes from a trusted proxy
+type Config struct {
+	// TrustedProxies are the IPs or CIDRs of the proxies in front of the gateway
+	TrustedProxies []string `json:"trusted_proxies" mapstructure:"trusted_proxies"`
+	// Headers are looked up in order, the first one found in the request is used.
+	// Each of them is Forwarded, X-Forwarded-For or X-Real-IP. Defaults to all of them
+	Headers []string `json:"headers"`
+	// ProxyProtocol makes the listeners accept PROXY protocol (v1 and v2)
+	// header from the trusted proxies
+	ProxyProtocol bool `json:"proxy_protocol" mapstructure:"proxy_protocol"`
+	// ProxyProtocolTimeout is the time to wait for the PROXY protocol header, in second(s)
+	ProxyProtocolTimeout int `json:"proxy_protocol_timeout" mapstructure:"proxy_protocol_timeout"`
+}
+
+// Resolver resolves the IP of the client of the requests
+type Resolver struct {
+	trusted []*net.IPNet
+	headers []string
+	timeout time.Duration
+	proxy   bool
+}
+
+// New returns the resolver of the given config
+func New(conf Config) (*Resolver, error) {
+	r := &Resolver{
+		timeout: time.Duration(conf.ProxyProtocolTimeout) * time.Second,
+		proxy:   conf.ProxyProtocol,
+	}
+	headers := conf.Headers
+	if len(headers) == 0 {
+		headers = defaultHeaders
+	}
+	for _, h := range headers {
+		h = http.CanonicalHeaderKey(h)
+		if h != HeaderForwarded && h != HeaderXForwardedFor && h != http.CanonicalHeaderKey(HeaderXRealIP) {
+			return nil, fmt.Errorf(
+				"unsupported client IP header `%s`, should be of (Forwarded/X-Forwarded-For/X-Real-IP)", h)
+		}
+		r.headers = append(r.headers, h)
+	}
+	if r.timeout == 0 {
+		r.timeout = 5 * time.Second
+	}
+
+	for _, proxy := range conf.TrustedProxies {
+		cidr, err := ParseCIDR(proxy)
+		if err != nil {
+			return nil, fmt.Errorf("invalid trusted proxy `%s` [%s]", proxy, err)
+		}
+		r.trusted = append(r.trusted, cidr)
+	}
+	return r, nil
+}
+
+// ParseCIDR parses the CIDR like 192.0.2.0/24 or 2001:db8::/32.
+// Plain IP is parsed as the CIDR having only that IP
+func ParseCIDR(s string) (*net.IPNet, error) {
+	s = strings.TrimSpace(s)
+	if !strings.Contains(s, "/") {
+		ip := net.ParseIP(s)
+		if ip == nil {
+			return nil, errors.New("not an IP or CIDR")
+		}
+		if ip4 := ip.To4(); ip4 != nil {
+			return &net.IPNet{IP: ip4, Mask: net.CIDRMask(32, 32)}, nil
+		}
+		return &net.IPNet{IP: ip, Mask: net.CIDRMask(128, 128)}, nil
+	}
+	_, cidr, err := net.ParseCIDR(s)
+	return cidr, err
+}
+
+// trusts reports if the ip belongs to a trusted proxy
+func (r *Resolver) trusts(ip net.IP) bool {
+	for _, cidr := range r.trusted {
+		if cidr.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// ClientIP resolves the IP of the client of the request. If the peer is a
+// trusted proxy, the addresses in the header are walked from right to left,
+// skipping the trusted proxies. The first untrusted address is the client
+func (r *Resolver) ClientIP(req *http.Request) string {
+	peer := parseIP(req.RemoteAddr)
+	if peer == nil {
+		return ""
+	}
+	if !r.trusts(peer) {
+		return peer.String()
+	}
+
+	for _, h := range r.headers {
+		values := req.Header.Values(h)
+		if len(values) == 0 {
+			continue
+		}
+
+		var hops []string
+		switch h {
+		case HeaderForwarded:
+			hops = forwardedFor(values)
+		case HeaderXForwardedFor:
+			for _, v := range values {
+				hops = append(hops, strings.Split(v, ",")...)
+			}
+		default:
+			hops = values[len(values)-1:]
+		}
+
+		client := peer
+		for i := len(hops) - 1; i >= 0; i-- {
+			ip := parseIP(strings.TrimSpace(hops[i]))
+			if ip == nil {
+				// the hop can not be trusted to have
+				// appended the addresses left of it
+				break
+			}
+			client = ip
+			if !r.trusts(ip) {
+				break
+			}
+		}
+		return client.String()
+	}
+	return peer.String()
+}
+
+// forwardedFor returns the for parameters of the Forwarded header (RFC 7239)
+func forwardedFor(values []string) []string {
+	var hops []string
+	for _, v := range values {
+		for _, element := range strings.Split(v, ",") {
+			for _, pair := range strings.Split(element, ";") {
+				pair = strings.TrimSpace(pair)
+				if len(pair) > 4 && strings.EqualFold(pair[:4], "for=") {
+					hops = append(hops, strings.Trim(pair[4:], `"`))
+				}
+			}
+		}
+	}
+	return hops
+}
+
+// parseIP parses IP written with or without the port, like
+// 192.0.2.1, 192.0.2.1:80, [2001:db8::1] and [2001:db8::1]:80
+func parseIP(addr string) net.IP {
+	if host, _, err := net.SplitHostPort(addr); err == nil {
+		addr = host
+	}
+	addr = strings.TrimSuffix(strings.TrimPrefix(addr, "["), "]")
+	if i := strings.Index(addr, "%"); i >= 0 {
+		addr = addr[:i] // zone of IPv6 address
+	}
+
+	ip := net.ParseIP(addr)
+	if ip4 := ip.To4(); ip4 != nil {
+		return ip4
+	}
+	return ip
+}
+
+// Middleware stores the resolved client IP in the request context
+func (r *Resolver) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		ip := r.ClientIP(req)
+		next.ServeHTTP(w, req.WithContext(WithClientIP(req.Context(), ip)))
+	})
+}
+
+type clientIPCtxKey struct{}
+
+// WithClientIP adds the client IP to the given context
+func WithClientIP(ctx context.Context, ip string) context.Context {
+	return context.WithValue(ctx, clientIPCtxKey{}, ip)
+}
+
+// FromCtx returns the client IP resolved by the middleware
+func FromCtx(ctx context.Context) (string, bool) {
+	ip, ok := ctx.Value(clientIPCtxKey{}).(string)
+	return ip, ok
+}
+
+// ClientIP returns the client IP of the request resolved by the middleware.
+// It falls back to the IP of the peer, if the request has not been through it
+func ClientIP(req *http.Request) string {
+	if ip, ok := FromCtx(req.Context()); ok {
+		return ip
+	}
+	if ip := parseIP(req.RemoteAddr); ip != nil {
+		return ip.String()
+	}
+	return ""
+}
@@ -0,0 +1,273 @@
+package router
+
+import (
+	"math"
+	"net"
+	"net/http"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Mux is the router matching requests on path, method, host and headers.
+// When more than one route matches a request, the one with the highest
+// priority serves it. Routes are prioritized by their hosts first, routes
+// having the exact request host, then the ones having a wildcard host with
+// the longest suffix and at last the ones matching any host. Then they are
+// prioritized by the kind of their path, exact paths first, then paths with
+// params, regex paths and at last path prefixes. Among the paths of same
+// kind, the one having more literal characters wins, then the one having
+// more of methods and headers constrained. Routes which are still equal
+// are tried in registration order
+type Mux struct {
+	mu          sync.RWMutex
+	entries     []*entry
+	middlewares []MiddlewareFunc
+
+	// notFound and methodNotAllowed are wrapped in the global
+	// middlewares, so that unmatched requests are logged and counted too
+	notFound         http.Handler
+	methodNotAllowed http.Handler
+}
+
+// entry is a registered route
+type entry struct {
+	route   *Route
+	hosts   []string // lower cased hosts of the route
+	path    *pathPattern
+	headers []headerMatcher
+	handler http.Handler
+	seq     int // registration order
+}
+
+// NewMux returns a new instance of Mux
+func NewMux() *Mux {
+	return &Mux{
+		notFound:         http.HandlerFunc(http.NotFound),
+		methodNotAllowed: http.HandlerFunc(methodNotAllowed),
+	}
+}
+
+// RegisterRoute registers the route and its handlerfunc to the router.
+// It panics if the route is invalid, which can be checked by Route.Validate
+func (m *Mux) RegisterRoute(route *Route, handler http.HandlerFunc, mwfs []MiddlewareFunc) {
+	p, err := compilePath(route.Path)
+	if err != nil {
+		panic(err)
+	}
+	headers, err := compileHeaders(route.Headers)
+	if err != nil {
+		panic(err)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	// middleware funcs provided by using Use() are intended to be used for
+	// all the services registed in the gateway. so they must be registered
+	// first in order. Then the service specific mwfs should be registered
+	finalMiddlewares := make([]MiddlewareFunc, 0, len(m.middlewares)+len(mwfs))
+	finalMiddlewares = append(finalMiddlewares, m.middlewares...)
+	finalMiddlewares = append(finalMiddlewares, mwfs...)
+
+	hosts := make([]string, 0, len(route.Hosts))
+	for _, h := range route.Hosts {
+		hosts = append(hosts, strings.ToLower(h))
+	}
+
+	m.entries = append(m.entries, &entry{
+		route:   route,
+		hosts:   hosts,
+		path:    p,
+		headers: headers,
+		handler: middleware(handler, finalMiddlewares...),
+		seq:     len(m.entries),
+	})
+	sort.SliceStable(m.entries, func(i, j int) bool {
+		return m.entries[i].higherPriority(m.entries[j])
+	})
+}
+
+// Use can be used to chain of global middlewares
+func (m *Mux) Use(mwf ...MiddlewareFunc) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.middlewares = append(m.middlewares, mwf...)
+	m.notFound = middleware(http.HandlerFunc(http.NotFound), m.middlewares...)
+	m.methodNotAllowed = middleware(http.HandlerFunc(methodNotAllowed), m.middlewares...)
+}
+
+func (m *Mux) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	// paths are cleaned like http.ServeMux does, so that
+	// the routes can not be bypassed using /../ or //
+	if req.Method != http.MethodConnect {
+		if p := cleanPath(req.URL.Path); p != req.URL.Path {
+			u := *req.URL
+			u.Path = p
+			http.Redirect(w, req, u.String(), http.StatusMovedPermanently)
+			return
+		}
+	}
+
+	host := req.Host
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+
+	e, params, allowed := m.match(req, strings.ToLower(host))
+	if e == nil {
+		m.mu.RLock()
+		notFound, methodNotAllowed := m.notFound, m.methodNotAllowed
+		m.mu.RUnlock()
+
+		if len(allowed) > 0 {
+			w.Header().Set("Allow", strings.Join(allowed, ", "))
+			methodNotAllowed.ServeHTTP(w, req)
+			return
+		}
+		notFound.ServeHTTP(w, req)
+		return
+	}
+
+	ctx := WithRoute(req.Context(), e.route)
+	if params != nil {
+		ctx = WithParams(ctx, params)
+	}
+	e.handler.ServeHTTP(w, req.WithContext(ctx))
+}
+
+// match returns the route matching the request. If no route matches, but some
+// of them would match with other methods, it returns the allowed methods.
+// CORS preflight request matches the route of the method it asks for,
+// so that the cors plugin of the route can answer it
+func (m *Mux) match(req *http.Request, host string) (*entry, Params, []string) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	method := req.Method
+	if requested := req.Header.Get("Access-Control-Request-Method"); requested != "" &&
+		method == http.MethodOptions {
+		method = requested
+	}
+
+	// entries are sorted on everything but the host rank, which depends
+	// on the request host. So the first match of the highest rank wins
+	var match *entry
+	var matchParams Params
+	var allowed []string
+	bestRank := -1
+	for _, e := range m.entries {
+		rank, ok := hostRank(e.hosts, host)
+		if !ok || rank <= bestRank || !e.matchHeaders(req.Header) {
+			continue
+		}
+		params, ok := e.path.match(req.URL.Path)
+		if !ok {
+			continue
+		}
+		if len(e.route.Methods) > 0 && !contains(e.route.Methods, method) {
+			for _, routeMethod := range e.route.Methods {
+				if !contains(allowed, routeMethod) {
+					allowed = append(allowed, routeMethod)
+				}
+			}
+			continue
+		}
+		match, matchParams, bestRank = e, params, rank
+	}
+
+	if match != nil {
+		return match, matchParams, nil
+	}
+	return nil, nil, allowed
+}
+
+func (e *entry) matchHeaders(h http.Header) bool {
+	for _, m := range e.headers {
+		if !m.match(h.Values(m.name)) {
+			return false
+		}
+	}
+	return true
+}
+
+func (e *entry) higherPriority(other *entry) bool {
+	if e.path.kind != other.path.kind {
+		return e.path.kind < other.path.kind
+	}
+	if e.path.literal != other.path.literal {
+		return e.path.literal > other.path.literal
+	}
+	if c, oc := e.constraints(), other.constraints(); c != oc {
+		return c > oc
+	}
+	return e.seq < other.seq
+}
+
+// it returns the number of request attributes other than path and host the route matches on
+func (e *entry) constraints() int {
+	n := len(e.headers)
+	if len(e.route.Methods) > 0 {
+		n++
+	}
+	return n
+}
+
+// hostRank reports if the host matches any of the hosts and how specific the
+// match is. Exact match ranks the highest, wildcard matches rank by the length
+// of their suffix and empty hosts, which match any host, rank the lowest
+func hostRank(hosts []string, host string) (int, bool) {
+	if len(hosts) == 0 {
+		return 0, true
+	}
+
+	rank, matched := 0, false
+	for _, h := range hosts {
+		switch {
+		case h == host:
+			return math.MaxInt32, true
+		case strings.HasPrefix(h, "*.") && strings.HasSuffix(host, h[1:]) && len(host) > len(h)-1:
+			if len(h) > rank {
+				rank, matched = len(h), true
+			}
+		}
+	}
+	return rank, matched
+}
+
+// cleanPath returns the canonical path, keeping the trailing slash
+func cleanPath(p string) string {
+	if p == "" {
+		return "/"
+	}
+	if p[0] != '/' {
+		p = "/" + p
+	}
+	np := path.Clean(p)
+	if p[len(p)-1] == '/' && np != "/" {
+		np += "/"
+	}
+	return np
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+func methodNotAllowed(w http.ResponseWriter, r *http.Request) {
+	http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+}
+
+// This applies middlewares in order they were registered
+func middleware(h http.Handler, mwf ...MiddlewareFunc) http.Handler {
+	for i := len(mwf) - 1; i >= 0; i-- {
+		h = mwf[i](h)
+	}
+	return h
+}
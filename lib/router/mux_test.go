@@ -0,0 +1,329 @@
+package router
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// newTestMux returns a mux having the routes registered in the given order.
+// Routes respond with the name of their service
+func newTestMux(routes []*Route) *Mux {
+	m := NewMux()
+	for _, route := range routes {
+		service := route.Service
+		m.RegisterRoute(route, func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte(service))
+		}, nil)
+	}
+	return m
+}
+
+func TestMuxPriority(t *testing.T) {
+	tests := []struct {
+		name    string
+		routes  []*Route
+		method  string
+		host    string
+		path    string
+		headers map[string]string
+		want    string
+	}{
+		{
+			name: "exact path before path with params",
+			routes: []*Route{
+				{Service: "template", Path: "/users/{id}"},
+				{Service: "exact", Path: "/users/me"},
+			},
+			path: "/users/me",
+			want: "exact",
+		},
+		{
+			name: "path with params before regex",
+			routes: []*Route{
+				{Service: "regex", Path: "~^/users/.+$"},
+				{Service: "template", Path: "/users/{id}"},
+			},
+			path: "/users/7",
+			want: "template",
+		},
+		{
+			name: "regex before prefix",
+			routes: []*Route{
+				{Service: "prefix", Path: "/users/*"},
+				{Service: "regex", Path: "~^/users/[0-9]+$"},
+			},
+			path: "/users/7",
+			want: "regex",
+		},
+		{
+			name: "longest prefix",
+			routes: []*Route{
+				{Service: "short", Path: "/api/*"},
+				{Service: "long", Path: "/api/v1/*"},
+			},
+			path: "/api/v1/users",
+			want: "long",
+		},
+		{
+			name: "prefix matches the path without wildcard",
+			routes: []*Route{
+				{Service: "root", Path: "/*"},
+				{Service: "api", Path: "/api/*"},
+			},
+			path: "/api",
+			want: "api",
+		},
+		{
+			name: "prefix does not match a longer segment",
+			routes: []*Route{
+				{Service: "root", Path: "/*"},
+				{Service: "api", Path: "/api/*"},
+			},
+			path: "/apis",
+			want: "root",
+		},
+		{
+			name: "path with more literal characters",
+			routes: []*Route{
+				{Service: "generic", Path: "/{kind}/{id}/orders"},
+				{Service: "specific", Path: "/users/{id}/orders"},
+			},
+			path: "/users/7/orders",
+			want: "specific",
+		},
+		{
+			name: "route constrained on method",
+			routes: []*Route{
+				{Service: "any", Path: "/api/*"},
+				{Service: "get", Path: "/api/*", Methods: []string{http.MethodGet}},
+			},
+			path: "/api/users",
+			want: "get",
+		},
+		{
+			name: "other method falls back to unconstrained route",
+			routes: []*Route{
+				{Service: "any", Path: "/api/*"},
+				{Service: "get", Path: "/api/*", Methods: []string{http.MethodGet}},
+			},
+			method: http.MethodPost,
+			path:   "/api/users",
+			want:   "any",
+		},
+		{
+			name: "route constrained on header",
+			routes: []*Route{
+				{Service: "any", Path: "/api/*"},
+				{Service: "v2", Path: "/api/*", Headers: map[string]string{"X-Version": "2"}},
+			},
+			path:    "/api/users",
+			headers: map[string]string{"X-Version": "2"},
+			want:    "v2",
+		},
+		{
+			name: "header of other value",
+			routes: []*Route{
+				{Service: "any", Path: "/api/*"},
+				{Service: "v2", Path: "/api/*", Headers: map[string]string{"X-Version": "2"}},
+			},
+			path:    "/api/users",
+			headers: map[string]string{"X-Version": "1"},
+			want:    "any",
+		},
+		{
+			name: "equal routes in registration order",
+			routes: []*Route{
+				{Service: "first", Path: "~^/a"},
+				{Service: "second", Path: "~^/a/b"},
+			},
+			path: "/a/b",
+			want: "first",
+		},
+		{
+			name: "exact host before wildcard host",
+			routes: []*Route{
+				{Service: "wildcard", Path: "/*", Hosts: []string{"*.example.com"}},
+				{Service: "exact", Path: "/*", Hosts: []string{"api.example.com"}},
+			},
+			host: "api.example.com",
+			path: "/users",
+			want: "exact",
+		},
+		{
+			name: "longest wildcard host",
+			routes: []*Route{
+				{Service: "short", Path: "/*", Hosts: []string{"*.example.com"}},
+				{Service: "long", Path: "/*", Hosts: []string{"*.eu.example.com"}},
+			},
+			host: "api.eu.example.com",
+			path: "/users",
+			want: "long",
+		},
+		{
+			name: "wildcard host before any host",
+			routes: []*Route{
+				{Service: "any", Path: "/*"},
+				{Service: "wildcard", Path: "/*", Hosts: []string{"*.example.com"}},
+			},
+			host: "api.example.com",
+			path: "/users",
+			want: "wildcard",
+		},
+		{
+			name: "wildcard host does not match the bare domain",
+			routes: []*Route{
+				{Service: "any", Path: "/*"},
+				{Service: "wildcard", Path: "/*", Hosts: []string{"*.example.com"}},
+			},
+			host: "example.com",
+			path: "/users",
+			want: "any",
+		},
+		{
+			name: "host before path kind",
+			routes: []*Route{
+				{Service: "exact", Path: "/users"},
+				{Service: "host", Path: "/*", Hosts: []string{"api.example.com"}},
+			},
+			host: "api.example.com",
+			path: "/users",
+			want: "host",
+		},
+		{
+			name: "host is matched case insensitively without port",
+			routes: []*Route{
+				{Service: "any", Path: "/*"},
+				{Service: "host", Path: "/*", Hosts: []string{"API.example.com"}},
+			},
+			host: "api.EXAMPLE.com:8080",
+			path: "/users",
+			want: "host",
+		},
+		{
+			name: "cors preflight matches the route of the requested method",
+			routes: []*Route{
+				{Service: "any", Path: "/api/*"},
+				{Service: "post", Path: "/api/*", Methods: []string{http.MethodPost}},
+			},
+			method:  http.MethodOptions,
+			path:    "/api/users",
+			headers: map[string]string{"Access-Control-Request-Method": http.MethodPost},
+			want:    "post",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := newTestMux(tt.routes)
+
+			method := tt.method
+			if method == "" {
+				method = http.MethodGet
+			}
+			req := httptest.NewRequest(method, tt.path, nil)
+			if tt.host != "" {
+				req.Host = tt.host
+			}
+			for name, value := range tt.headers {
+				req.Header.Set(name, value)
+			}
+			rec := httptest.NewRecorder()
+			m.ServeHTTP(rec, req)
+
+			if rec.Code != http.StatusOK || rec.Body.String() != tt.want {
+				t.Errorf("got %d %q, want %q", rec.Code, rec.Body.String(), tt.want)
+			}
+		})
+	}
+}
+
+func TestMuxUnmatched(t *testing.T) {
+	m := newTestMux([]*Route{
+		{Service: "get", Path: "/users", Methods: []string{http.MethodGet}},
+		{Service: "put", Path: "/users", Methods: []string{http.MethodPut}},
+	})
+
+	tests := []struct {
+		name       string
+		method     string
+		path       string
+		wantStatus int
+		wantAllow  string
+		wantLoc    string
+	}{
+		{name: "not found", method: http.MethodGet, path: "/orders", wantStatus: http.StatusNotFound},
+		{
+			name:       "method not allowed",
+			method:     http.MethodPost,
+			path:       "/users",
+			wantStatus: http.StatusMethodNotAllowed,
+			wantAllow:  "GET, PUT",
+		},
+		{
+			name:       "unclean path is redirected",
+			method:     http.MethodGet,
+			path:       "/orders/../users",
+			wantStatus: http.StatusMovedPermanently,
+			wantLoc:    "/users",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			m.ServeHTTP(rec, httptest.NewRequest(tt.method, tt.path, nil))
+
+			if rec.Code != tt.wantStatus {
+				t.Errorf("got status %d, want %d", rec.Code, tt.wantStatus)
+			}
+			if got := rec.Header().Get("Allow"); got != tt.wantAllow {
+				t.Errorf("got Allow %q, want %q", got, tt.wantAllow)
+			}
+			if got := rec.Header().Get("Location"); got != tt.wantLoc {
+				t.Errorf("got Location %q, want %q", got, tt.wantLoc)
+			}
+		})
+	}
+}
+
+func TestMuxParams(t *testing.T) {
+	tests := []struct {
+		path      string
+		reqPath   string
+		want      Params
+		wantMatch bool
+	}{
+		{path: "/users/{id}", reqPath: "/users/7", want: Params{"id": "7"}, wantMatch: true},
+		{path: "/users/{id:[0-9]+}", reqPath: "/users/me", wantMatch: false},
+		{path: "/files/*", reqPath: "/files/a/b", want: Params{WildcardParam: "/a/b"}, wantMatch: true},
+		{
+			path:      "/users/{id}/*",
+			reqPath:   "/users/7/orders",
+			want:      Params{"id": "7", WildcardParam: "/orders"},
+			wantMatch: true,
+		},
+		{path: `~^/v(?P<version>[0-9]+)/`, reqPath: "/v2/users", want: Params{"version": "2"}, wantMatch: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			p, err := compilePath(tt.path)
+			if err != nil {
+				t.Fatalf("invalid path: %s", err)
+			}
+			params, ok := p.match(tt.reqPath)
+			if ok != tt.wantMatch {
+				t.Fatalf("got match %t, want %t", ok, tt.wantMatch)
+			}
+			if len(params) != len(tt.want) {
+				t.Fatalf("got params %v, want %v", params, tt.want)
+			}
+			for name, value := range tt.want {
+				if params[name] != value {
+					t.Errorf("got params %v, want %v", params, tt.want)
+				}
+			}
+		})
+	}
+}
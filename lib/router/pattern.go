@@ -0,0 +1,184 @@
+package router
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// kinds of path patterns in the order of their priority
+const (
+	exactPath = iota
+	templatePath
+	regexPath
+	prefixPath
+)
+
+// WildcardParam is the param holding the rest of the path matched by /*
+const WildcardParam = "*"
+
+var paramName = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// pathPattern is the compiled path of a route. Supported paths are
+//
+//	/users             exact path
+//	/users/*           path prefix, the rest of the path is the wildcard param
+//	/users/{id}        named param matching a path segment
+//	/users/{id:[0-9]+} named param matching the regex
+//	~^/v[0-9]+/users$  regex, named groups are the params
+type pathPattern struct {
+	kind int
+	// path is the exact path or the prefix of prefix paths
+	path string
+	// number of literal characters, used to prioritize more specific patterns
+	literal  int
+	re       *regexp.Regexp
+	wildcard bool
+}
+
+func compilePath(path string) (*pathPattern, error) {
+	if strings.HasPrefix(path, "~") {
+		re, err := regexp.Compile(path[1:])
+		if err != nil {
+			return nil, fmt.Errorf("invalid path regex `%s` [%s]", path, err)
+		}
+		return &pathPattern{kind: regexPath, re: re}, nil
+	}
+
+	if !strings.HasPrefix(path, "/") {
+		return nil, fmt.Errorf("invalid path `%s`, it must start with /", path)
+	}
+
+	p := &pathPattern{kind: exactPath, path: path}
+	if strings.HasSuffix(path, "/*") {
+		p.kind = prefixPath
+		p.wildcard = true
+		p.path = strings.TrimSuffix(path, "/*")
+	}
+	if strings.Contains(p.path, "*") {
+		return nil, fmt.Errorf("invalid path `%s`, * is only allowed at the end as /*", path)
+	}
+
+	if !strings.ContainsAny(p.path, "{}") {
+		p.literal = len(p.path)
+		return p, nil
+	}
+
+	// paths having params are matched using the regex built from them
+	var b strings.Builder
+	b.WriteString("^")
+	params := map[string]bool{}
+	for _, segment := range strings.Split(p.path, "/")[1:] {
+		b.WriteString("/")
+
+		if !strings.HasPrefix(segment, "{") || !strings.HasSuffix(segment, "}") {
+			if strings.ContainsAny(segment, "{}") {
+				return nil, fmt.Errorf("invalid path `%s`, a param must be a whole path segment", path)
+			}
+			p.literal += len(segment) + 1
+			b.WriteString(regexp.QuoteMeta(segment))
+			continue
+		}
+
+		name, expr := segment[1:len(segment)-1], "[^/]+"
+		if i := strings.Index(name, ":"); i >= 0 {
+			name, expr = name[:i], name[i+1:]
+			if _, err := regexp.Compile(expr); err != nil {
+				return nil, fmt.Errorf("invalid regex of param `%s` in path `%s` [%s]", name, path, err)
+			}
+		}
+		if !paramName.MatchString(name) {
+			return nil, fmt.Errorf("invalid param name `%s` in path `%s`", name, path)
+		}
+		if params[name] {
+			return nil, fmt.Errorf("param `%s` is repeated in path `%s`", name, path)
+		}
+		params[name] = true
+		fmt.Fprintf(&b, "(?P<%s>%s)", name, expr)
+	}
+	if p.wildcard {
+		b.WriteString("(/.*)?")
+	} else {
+		p.kind = templatePath
+	}
+	b.WriteString("$")
+
+	re, err := regexp.Compile(b.String())
+	if err != nil {
+		return nil, fmt.Errorf("invalid path `%s` [%s]", path, err)
+	}
+	p.re = re
+	return p, nil
+}
+
+// match reports if the path matches and returns the params found in it
+func (p *pathPattern) match(path string) (Params, bool) {
+	if p.re == nil {
+		if p.kind == exactPath {
+			return nil, path == p.path
+		}
+		if path == p.path || strings.HasPrefix(path, p.path+"/") {
+			return Params{WildcardParam: path[len(p.path):]}, true
+		}
+		return nil, false
+	}
+
+	m := p.re.FindStringSubmatch(path)
+	if m == nil {
+		return nil, false
+	}
+
+	params := Params{}
+	for i, name := range p.re.SubexpNames() {
+		if name != "" {
+			params[name] = m[i]
+		}
+	}
+	if p.wildcard {
+		params[WildcardParam] = m[len(m)-1]
+	}
+	return params, true
+}
+
+// headerMatcher matches the value of a request header. Empty value only
+// requires the header to be present, value starting with ~ is a regex
+type headerMatcher struct {
+	name  string
+	value string
+	re    *regexp.Regexp
+}
+
+func compileHeaders(headers map[string]string) ([]headerMatcher, error) {
+	matchers := make([]headerMatcher, 0, len(headers))
+	for name, value := range headers {
+		if name == "" {
+			return nil, errors.New("header name can not be blank")
+		}
+		m := headerMatcher{name: name, value: value}
+		if strings.HasPrefix(value, "~") {
+			re, err := regexp.Compile(value[1:])
+			if err != nil {
+				return nil, fmt.Errorf("invalid regex of header `%s` [%s]", name, err)
+			}
+			m.re = re
+		}
+		matchers = append(matchers, m)
+	}
+	return matchers, nil
+}
+
+func (m headerMatcher) match(values []string) bool {
+	if len(values) == 0 {
+		return false
+	}
+	if m.value == "" {
+		return true
+	}
+	for _, v := range values {
+		if m.re != nil && m.re.MatchString(v) || m.re == nil && v == m.value {
+			return true
+		}
+	}
+	return false
+}
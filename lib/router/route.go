@@ -0,0 +1,108 @@
+package router
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+type routeCtxKey struct{}
+
+type paramsCtxKey struct{}
+
+// Route describes a registered route. Router makes it available in the
+// request context, so that middlewares can identify the route being served.
+// Requests are matched on path and on methods, hosts and headers if provided
+type Route struct {
+	Service string
+	Path    string
+	Methods []string
+	// Hosts can have a leading wildcard like *.example.com,
+	// which matches all the subdomains of example.com
+	Hosts []string
+	// Headers maps the header names to the values they must have
+	Headers map[string]string
+}
+
+// Params are the named params of the route path found in the request path
+type Params map[string]string
+
+// Validate checks if the route can be registered
+func (r *Route) Validate() error {
+	if _, err := compilePath(r.Path); err != nil {
+		return err
+	}
+	for _, m := range r.Methods {
+		if m == "" || strings.ToUpper(m) != m {
+			return fmt.Errorf("invalid method `%s`, it must be in upper case", m)
+		}
+	}
+	for _, h := range r.Hosts {
+		if h == "" {
+			return errors.New("host can not be blank")
+		}
+		if strings.Contains(strings.TrimPrefix(h, "*."), "*") || strings.ContainsAny(h, ":/") {
+			return fmt.Errorf("invalid host `%s`, only a leading *. wildcard is allowed", h)
+		}
+	}
+	_, err := compileHeaders(r.Headers)
+	return err
+}
+
+// Conflicts reports if both the routes would match the same requests
+func (r *Route) Conflicts(other *Route) bool {
+	if r.Path != other.Path || len(r.Headers) != len(other.Headers) {
+		return false
+	}
+	for name, value := range r.Headers {
+		if v, found := other.Headers[name]; !found || v != value {
+			return false
+		}
+	}
+	return overlaps(r.Methods, other.Methods) && overlaps(r.Hosts, other.Hosts)
+}
+
+// it reports if both the lists have a common value or both are empty.
+// Empty list matches any value, but a route having the list has
+// higher priority than the one not having it, so they don't conflict
+func overlaps(a, b []string) bool {
+	if len(a) == 0 || len(b) == 0 {
+		return len(a) == len(b)
+	}
+	for _, x := range a {
+		for _, y := range b {
+			if strings.EqualFold(x, y) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// WithRoute adds the given route to the provided context
+func WithRoute(ctx context.Context, route *Route) context.Context {
+	return context.WithValue(ctx, routeCtxKey{}, route)
+}
+
+// RouteFromCtx retrieves the route from the given context.
+// It returns an empty route if the request was not routed
+func RouteFromCtx(ctx context.Context) *Route {
+	route, ok := ctx.Value(routeCtxKey{}).(*Route)
+	if !ok {
+		return &Route{}
+	}
+	return route
+}
+
+// WithParams adds the given route params to the provided context
+func WithParams(ctx context.Context, params Params) context.Context {
+	return context.WithValue(ctx, paramsCtxKey{}, params)
+}
+
+// ParamsFromCtx retrieves the route params from the given context.
+// It returns nil if the route has no params
+func ParamsFromCtx(ctx context.Context) Params {
+	params, _ := ctx.Value(paramsCtxKey{}).(Params)
+	return params
+}
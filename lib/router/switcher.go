@@ -0,0 +1,42 @@
+package router
+
+import (
+	"net/http"
+	"sync/atomic"
+)
+
+// atomic.Value requires all the stored values to be of same concrete type
+type routerHolder struct {
+	Router
+}
+
+// Switcher is a http.Handler which delegates every request to the current router.
+// The router can be swapped at runtime. Requests which are already being
+// served keep using the router they were dispatched to
+type Switcher struct {
+	current atomic.Value
+}
+
+// NewSwitcher returns a switcher which initially dispatches requests to the given router
+func NewSwitcher(r Router) *Switcher {
+	s := &Switcher{}
+	s.current.Store(routerHolder{r})
+	return s
+}
+
+func (s *Switcher) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	s.Router().ServeHTTP(w, req)
+}
+
+// Router returns the router to which requests are currently dispatched
+func (s *Switcher) Router() Router {
+	return s.current.Load().(routerHolder).Router
+}
+
+// Swap atomically replaces the current router with the given one
+// and returns the replaced router
+func (s *Switcher) Swap(r Router) Router {
+	old := s.Router()
+	s.current.Store(routerHolder{r})
+	return old
+}
@@ -0,0 +1,128 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/AyushSenapati/guardian/lib/plugin/cache"
+	"github.com/AyushSenapati/guardian/lib/proxy"
+	"github.com/AyushSenapati/guardian/lib/service"
+)
+
+// Server implements admin.Manager, so that
+// admin API can manage the services at runtime
+
+// Definitions returns currently registered service definitions
+func (s *Server) Definitions() []*service.Definition {
+	s.reloadMu.Lock()
+	defer s.reloadMu.Unlock()
+
+	return append([]*service.Definition{}, s.definitions...)
+}
+
+// UpdateDefinitions applies the definitions returned by the update func
+// by registering them in a new router and writes them to the service
+// definition file, so that the changes survive restarts and reloads
+func (s *Server) UpdateDefinitions(
+	update func([]*service.Definition) ([]*service.Definition, error)) error {
+	s.reloadMu.Lock()
+	defer s.reloadMu.Unlock()
+
+	definitions, err := update(append([]*service.Definition{}, s.definitions...))
+	if err != nil {
+		return err
+	}
+
+	// definitions are written to a temporary file first, which replaces
+	// the definition file only once they are applied successfully
+	tmpFname, err := s.writeDefinitions(definitions)
+	if err != nil {
+		return err
+	}
+	if err := s.applyDefinitions(definitions); err != nil {
+		os.Remove(tmpFname)
+		return err
+	}
+	if err := os.Rename(tmpFname, s.svcDefinitionFname); err != nil {
+		os.Remove(tmpFname)
+		return fmt.Errorf(
+			"definitions are applied but could not be saved to `%s` [%s]", s.svcDefinitionFname, err)
+	}
+	return nil
+}
+
+// it writes the definitions to a temporary file next to the service
+// definition file having its mode and returns the name of the file
+func (s *Server) writeDefinitions(definitions []*service.Definition) (string, error) {
+	b, err := json.MarshalIndent(definitions, "", "    ")
+	if err != nil {
+		return "", fmt.Errorf("could not marshal service definitions [%s]", err)
+	}
+
+	mode := os.FileMode(0644)
+	if info, err := os.Stat(s.svcDefinitionFname); err == nil {
+		mode = info.Mode().Perm()
+	}
+
+	dir, base := filepath.Split(s.svcDefinitionFname)
+	f, err := ioutil.TempFile(dir, "."+base+".")
+	if err != nil {
+		return "", fmt.Errorf("could not save service definitions [%s]", err)
+	}
+	_, err = f.Write(append(b, '\n'))
+	if err == nil {
+		err = f.Chmod(mode)
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(f.Name())
+		return "", fmt.Errorf("could not save service definitions [%s]", err)
+	}
+	return f.Name(), nil
+}
+
+// Routes returns the registered routes along with
+// global and service specific middlewares in the order they are applied
+func (s *Server) Routes() []proxy.RouteInfo {
+	s.reloadMu.Lock()
+	defer s.reloadMu.Unlock()
+
+	var globals []string
+	for _, m := range s.globalMiddlewares() {
+		globals = append(globals, m.name)
+	}
+
+	routes := make([]proxy.RouteInfo, 0, len(s.Register.Routes()))
+	for _, route := range s.Register.Routes() {
+		route.Middlewares = append(append([]string{}, globals...), route.Middlewares...)
+		routes = append(routes, route)
+	}
+	return routes
+}
+
+// Health returns health state of upstream targets of the registered services
+func (s *Server) Health() []proxy.ServiceHealth {
+	s.reloadMu.Lock()
+	defer s.reloadMu.Unlock()
+
+	return s.Register.Health()
+}
+
+// PurgeCache removes the cached responses of the service
+// which request path starts with the prefix
+func (s *Server) PurgeCache(name, prefix string) (int, bool) {
+	s.reloadMu.Lock()
+	defer s.reloadMu.Unlock()
+
+	for _, def := range s.definitions {
+		if def.Name == name {
+			return cache.Purge(name, prefix)
+		}
+	}
+	return 0, false
+}
@@ -0,0 +1,153 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/AyushSenapati/guardian/lib/consumer"
+	"github.com/AyushSenapati/guardian/lib/logger"
+	"github.com/AyushSenapati/guardian/lib/proxy"
+	"github.com/AyushSenapati/guardian/lib/service"
+	"github.com/AyushSenapati/guardian/lib/watcher"
+)
+
+// Reload re-reads the service definition file, registers the services in a
+// new router and atomically swaps it with the current one. Requests which are
+// in flight finish on the old routing table. If the definition file can not
+// be read or the services can not be registered, current routing table is kept
+func (s *Server) Reload() error {
+	return s.reload(true)
+}
+
+// reloadChanged reloads the service definitions only if the definition file
+// differs from the registered definitions. So the definitions written by
+// admin API are not registered once again when the file watcher sees them
+func (s *Server) reloadChanged() error {
+	return s.reload(false)
+}
+
+func (s *Server) reload(force bool) error {
+	s.reloadMu.Lock()
+	defer s.reloadMu.Unlock()
+
+	definitions, err := s.ServiceLoader.ReadServiceDefinitions(s.svcDefinitionFname)
+	if err != nil {
+		return err
+	}
+
+	if !force && sameDefinitions(definitions, s.definitions) {
+		return nil
+	}
+
+	if err := s.applyDefinitions(definitions); err != nil {
+		return err
+	}
+
+	logger.Info("service definitions reloaded", "services", len(definitions))
+	return nil
+}
+
+func sameDefinitions(a, b []*service.Definition) bool {
+	ab, err := json.Marshal(a)
+	if err != nil {
+		return false
+	}
+	bb, err := json.Marshal(b)
+	if err != nil {
+		return false
+	}
+	return bytes.Equal(ab, bb)
+}
+
+// ReloadConsumers re-reads the consumer file. If the file can not
+// be read or is invalid, current consumers are kept as they are
+func (s *Server) ReloadConsumers() error {
+	if err := consumer.Load(s.consumersFname); err != nil {
+		return err
+	}
+
+	logger.Info("consumers reloaded")
+	return nil
+}
+
+// it registers the given definitions in a new router and swaps it with
+// the current router only if all the services are registered successfully.
+// Caller must hold the reloadMu
+func (s *Server) applyDefinitions(definitions []*service.Definition) error {
+	if err := service.ValidateDefinitions(definitions); err != nil {
+		return err
+	}
+
+	r := s.CreateRouter()
+	register := proxy.NewRegister(r)
+	loader := service.NewLoader(register)
+
+	if err := loader.RegisterServices(definitions); err != nil {
+		register.Close()
+		return err
+	}
+
+	s.switcher.Swap(r)
+	register.Commit()
+	s.Register.Close()
+	s.Register, s.ServiceLoader = register, loader
+	s.definitions = definitions
+
+	return nil
+}
+
+// it reloads service definitions, consumers and TLS certificates on SIGHUP and,
+// if configured, whenever the service definition or consumer file changes on disk
+func (s *Server) watchServiceDefinitions(ctx context.Context) {
+	reload := func() {
+		if err := s.Reload(); err != nil {
+			logger.Error("reload failed, keeping current services", "error", err)
+		}
+	}
+	reloadChanged := func() {
+		if err := s.reloadChanged(); err != nil {
+			logger.Error("reload failed, keeping current services", "error", err)
+		}
+	}
+	reloadConsumers := func() {
+		if err := s.ReloadConsumers(); err != nil {
+			logger.Error("reload failed, keeping current consumers", "error", err)
+		}
+	}
+
+	if s.globalConfig.WatchDefinitions {
+		interval := time.Duration(s.globalConfig.WatchInterval) * time.Second
+		for _, w := range []*watcher.Watcher{
+			watcher.New(s.svcDefinitionFname, interval, reloadChanged),
+			watcher.New(s.consumersFname, interval, reloadConsumers),
+		} {
+			w.Start()
+			s.watchers = append(s.watchers, w)
+		}
+	}
+
+	hupChan := make(chan os.Signal, 1)
+	signal.Notify(hupChan, syscall.SIGHUP)
+
+	go func() {
+		defer signal.Stop(hupChan)
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-hupChan:
+				logger.Info("SIGHUP received, reloading")
+				if err := s.ReloadCertificates(); err != nil {
+					logger.Error("reload failed, keeping current certificates", "error", err)
+				}
+				reloadConsumers()
+				reload()
+			}
+		}
+	}()
+}
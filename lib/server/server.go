@@ -4,17 +4,25 @@ import (
 	"context"
 	"fmt"
 	"html"
-	"log"
+	"net"
 	"net/http"
 	"os"
 	"strconv"
+	"sync"
 	"time"
 
 	"github.com/AyushSenapati/guardian/config"
+	"github.com/AyushSenapati/guardian/lib/accesslog"
+	"github.com/AyushSenapati/guardian/lib/admin"
+	"github.com/AyushSenapati/guardian/lib/consumer"
+	"github.com/AyushSenapati/guardian/lib/logger"
+	"github.com/AyushSenapati/guardian/lib/metrics"
 	"github.com/AyushSenapati/guardian/lib/middleware"
 	"github.com/AyushSenapati/guardian/lib/proxy"
+	"github.com/AyushSenapati/guardian/lib/realip"
 	"github.com/AyushSenapati/guardian/lib/router"
 	"github.com/AyushSenapati/guardian/lib/service"
+	"github.com/AyushSenapati/guardian/lib/watcher"
 )
 
 // Server defines the core DS of Guardian server
@@ -24,6 +32,30 @@ type Server struct {
 	Register      *proxy.Register
 	ServiceLoader *service.Loader
 	stopChan      chan struct{}
+
+	// switcher dispatches requests to the current router,
+	// which gets replaced on every reload of service definitions
+	switcher           *router.Switcher
+	svcDefinitionFname string
+	consumersFname     string
+	reloadMu           sync.Mutex
+	watchers           []*watcher.Watcher
+
+	// definitions are the currently registered service definitions
+	definitions []*service.Definition
+	adminServer *http.Server
+	accessLog   router.MiddlewareFunc
+
+	tlsServer *http.Server
+	certStore *certStore
+
+	realIP *realip.Resolver
+}
+
+// namedMiddleware lets the admin API report the global middleware chain
+type namedMiddleware struct {
+	name string
+	mwf  router.MiddlewareFunc
 }
 
 // NewServerWithConfig takes the config specification and returns a server obj
@@ -35,47 +67,114 @@ func NewServerWithConfig(config *config.Specification) *Server {
 }
 
 // Start will start the gateway service
-func (s *Server) Start(ctx context.Context, svcDefinitionFname string) {
+func (s *Server) Start(ctx context.Context, svcDefinitionFname, consumersFname string) {
 
 	// this triggers the server close once
 	// the parent context gets canceled
 	go func() {
 		<-ctx.Done()
-		log.Println(
-			"Guardian >> Oopps! Gotta go. till then manage your services",
-			html.UnescapeString("&#"+strconv.Itoa(128517)+";"),
+		logger.Info(
+			"Guardian >> Oopps! Gotta go. till then manage your services " +
+				html.UnescapeString("&#"+strconv.Itoa(128517)+";"),
 		)
 		s.Close()
 	}()
 
+	s.svcDefinitionFname = svcDefinitionFname
+	s.consumersFname = consumersFname
+
+	accessLog, err := accesslog.New(s.globalConfig.AccessLog)
+	if err != nil {
+		logger.Fatal("could not configure access log", "error", err)
+	}
+	s.accessLog = accessLog
+
+	if s.realIP, err = realip.New(s.globalConfig.RealIP); err != nil {
+		logger.Fatal("could not configure client IP resolution", "error", err)
+	}
+
 	// Create a router interface
 	r := s.CreateRouter()
 	// Register the router interface in the proxy register
 	s.Register = proxy.NewRegister(r)
 	// Register the proxy register in service loader
 	s.ServiceLoader = service.NewLoader(s.Register)
+	s.switcher = router.NewSwitcher(r)
+
+	// plain HTTP listener serves the services unless it is configured
+	// to redirect the requests to HTTPS or client certificates are required
+	var httpHandler http.Handler = s.switcher
+
+	if s.globalConfig.TLS.Enabled {
+		if s.certStore, err = newCertStore(s.globalConfig.TLS.Certificates); err != nil {
+			logger.Fatal("could not load TLS certificates", "error", err)
+		}
+		tlsConfig, err := newTLSConfig(s.globalConfig.TLS, s.certStore)
+		if err != nil {
+			logger.Fatal("could not configure TLS", "error", err)
+		}
+		s.watchCertificates()
+
+		// services requiring client certificates must not be reachable
+		// over plain HTTP, so the requests are always redirected then
+		if s.globalConfig.TLS.RedirectHTTP || s.globalConfig.TLS.ClientAuth == "require" {
+			httpHandler = s.redirectToHTTPS()
+		}
+
+		go func() {
+			if err := s.startHTTPSServer(s.switcher, tlsConfig); err != http.ErrServerClosed {
+				logger.Fatal("TLS server failed", "error", err)
+			}
+		}()
+	}
 
 	go func() {
-		if err := s.startHTTPServer(r); err == http.ErrServerClosed {
-			log.Println(
+		if err := s.startHTTPServer(httpHandler); err == http.ErrServerClosed {
+			logger.Info(
 				"Guardian >> mmm, lemme wait till your active connections're closed...")
 		} else {
-			log.Fatal(err)
+			logger.Fatal("server failed", "error", err)
 		}
 	}()
 
+	// consumers are loaded before the services, so that
+	// authentication plugins can identify them from the start
+	if err := consumer.Load(consumersFname); err != nil {
+		logger.Error("could not load consumers", "error", err)
+	}
+
 	// routes can be loaded even after the server has started.
 	// But till the routes are loaded it is obvious
 	// accessing those routes will give 404 NotFound
 	// r.LoadRouterDefinitions("definitions.json")
 	definitions := s.ServiceLoader.LoadServiceDefinitions(svcDefinitionFname)
-	s.ServiceLoader.RegisterServices(definitions)
+	if err := service.ValidateDefinitions(definitions); err != nil {
+		logger.Fatal("invalid service definitions", "error", err)
+	}
+	if err := s.ServiceLoader.RegisterServices(definitions); err != nil {
+		logger.Fatal("could not register services", "error", err)
+	}
+	s.Register.Commit()
+	s.definitions = definitions
+
+	s.watchServiceDefinitions(ctx)
+
+	if s.globalConfig.AdminPort != 0 {
+		if s.globalConfig.AdminToken == "" {
+			logger.Fatal("admin API requires admintoken to be configured")
+		}
+		go func() {
+			if err := s.startAdminServer(); err != http.ErrServerClosed {
+				logger.Fatal("admin server failed", "error", err)
+			}
+		}()
+	}
 }
 
 // Wait will wait till any signal is
 // received on server stop channel to stop the server
 func (s *Server) Wait(ctx context.Context) {
-	log.Printf("info: PPID:%d, PID:%d", os.Getppid(), os.Getpid())
+	logger.Info("waiting for stop signal", "ppid", os.Getppid(), "pid", os.Getpid())
 	<-s.stopChan
 	time.Sleep(2 * time.Second)
 }
@@ -84,6 +183,14 @@ func (s *Server) Wait(ctx context.Context) {
 func (s *Server) Close() error {
 	defer close(s.stopChan)
 
+	for _, w := range s.watchers {
+		w.Stop()
+	}
+
+	s.reloadMu.Lock()
+	s.Register.Close()
+	s.reloadMu.Unlock()
+
 	ctx, cancel := context.WithTimeout(
 		context.Background(), time.Duration(s.globalConfig.GraceTimeout)*time.Second)
 	defer cancel()
@@ -93,17 +200,29 @@ func (s *Server) Close() error {
 		if ctx.Err() == context.Canceled {
 			return
 		} else if ctx.Err() == context.DeadlineExceeded {
-			log.Println(
+			logger.Warn(
 				"Guardian >> F**k! lost my patience. force terminating connections",
 			)
 		}
 	}(ctx)
 
+	if s.adminServer != nil {
+		if err := s.adminServer.Shutdown(ctx); err != nil {
+			logger.Error("admin server shutdown failed", "error", err)
+		}
+	}
+
+	if s.tlsServer != nil {
+		if err := s.tlsServer.Shutdown(ctx); err != nil {
+			logger.Error("TLS server shutdown failed", "error", err)
+		}
+	}
+
 	return s.server.Shutdown(ctx)
 }
 
 // it creates the http.Server instance, listens and serves http requests
-func (s *Server) startHTTPServer(r router.Router) error {
+func (s *Server) startHTTPServer(r http.Handler) error {
 	addr := fmt.Sprintf(":%v", s.globalConfig.Port)
 
 	s.server = &http.Server{
@@ -112,23 +231,74 @@ func (s *Server) startHTTPServer(r router.Router) error {
 		ReadTimeout:  time.Duration(s.globalConfig.ReadTimeout) * time.Second,
 		WriteTimeout: time.Duration(s.globalConfig.WriteTimeout) * time.Second,
 		IdleTimeout:  time.Duration(s.globalConfig.IdleTimeout) * time.Second,
+		ErrorLog:     logger.StdLogger(logger.ErrorLevel),
+	}
+
+	logger.Info("server will listen", "addr", addr)
+
+	l, err := s.realIP.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	return s.server.Serve(l)
+}
+
+// it starts the admin API on a separate listener
+func (s *Server) startAdminServer() error {
+	addr := net.JoinHostPort(s.globalConfig.AdminAddress, strconv.Itoa(s.globalConfig.AdminPort))
+
+	s.adminServer = &http.Server{
+		Addr:         addr,
+		Handler:      admin.NewAPI(s, string(s.globalConfig.AdminToken)),
+		ReadTimeout:  time.Duration(s.globalConfig.ReadTimeout) * time.Second,
+		WriteTimeout: time.Duration(s.globalConfig.WriteTimeout) * time.Second,
+		IdleTimeout:  time.Duration(s.globalConfig.IdleTimeout) * time.Second,
+		ErrorLog:     logger.StdLogger(logger.ErrorLevel),
 	}
 
-	log.Println("srv: will listen on", addr)
+	logger.Info("admin API will listen", "addr", addr)
 
-	return s.server.ListenAndServe()
+	return s.adminServer.ListenAndServe()
 }
 
 // CreateRouter returns a router interface
 func (s *Server) CreateRouter() router.Router {
-	r := router.NewHTTPServeMux()
+	r := router.NewMux()
+
+	for _, m := range s.globalMiddlewares() {
+		r.Use(m.mwf)
+	}
+
+	return r
+}
+
+// it returns the configured global middlewares in the order they must be used
+func (s *Server) globalMiddlewares() []namedMiddleware {
+	var mws []namedMiddleware
 
 	// RequestID must be the first middleware to be registered
 	// if it is configured, so that all other handlers can access requestID
 	// from the context to log the errors in case any
 	if s.globalConfig.AddReqID {
-		r.Use(middleware.RequestID)
+		mws = append(mws, namedMiddleware{"request-id", middleware.RequestID})
 	}
 
-	return r
+	// client IP is resolved before any other middleware can use it
+	if s.realIP != nil {
+		mws = append(mws, namedMiddleware{"real-ip", s.realIP.Middleware})
+	}
+
+	if clientAuthEnabled(s.globalConfig.TLS) {
+		mws = append(mws, namedMiddleware{"client-cert", middleware.ClientCertificate})
+	}
+
+	if s.globalConfig.Metrics {
+		mws = append(mws, namedMiddleware{"metrics", metrics.Middleware})
+	}
+
+	// access log middleware is used even if access log is disabled globally,
+	// so that services overriding the global config can take over logging
+	mws = append(mws, namedMiddleware{"access-log", s.accessLog})
+
+	return mws
 }
@@ -0,0 +1,231 @@
+package server
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/AyushSenapati/guardian/config"
+	"github.com/AyushSenapati/guardian/lib/logger"
+	"github.com/AyushSenapati/guardian/lib/watcher"
+)
+
+var tlsVersions = map[string]uint16{
+	"1.0": tls.VersionTLS10,
+	"1.1": tls.VersionTLS11,
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+// certStore holds the certificates served by the HTTPS listener.
+// Certificates can be reloaded from disk while the listener is serving
+type certStore struct {
+	sync.RWMutex
+	specs []config.Certificate
+	certs []*tls.Certificate
+}
+
+func newCertStore(specs []config.Certificate) (*certStore, error) {
+	if len(specs) == 0 {
+		return nil, errors.New("at least one certificate is required to enable TLS")
+	}
+
+	store := &certStore{specs: specs}
+	if err := store.reload(); err != nil {
+		return nil, err
+	}
+	return store, nil
+}
+
+// reload loads all the certificates from disk. If any of them
+// fails to load, the certificates being served are kept as they are
+func (cs *certStore) reload() error {
+	certs := make([]*tls.Certificate, 0, len(cs.specs))
+	for _, spec := range cs.specs {
+		cert, err := tls.LoadX509KeyPair(spec.CertFile, spec.KeyFile)
+		if err != nil {
+			return fmt.Errorf("could not load certificate %s [%s]", spec.CertFile, err)
+		}
+		if cert.Leaf, err = x509.ParseCertificate(cert.Certificate[0]); err != nil {
+			return fmt.Errorf("could not parse certificate %s [%s]", spec.CertFile, err)
+		}
+		certs = append(certs, &cert)
+	}
+
+	cs.Lock()
+	defer cs.Unlock()
+	cs.certs = certs
+	return nil
+}
+
+// getCertificate selects the certificate based on the server name requested by the client
+func (cs *certStore) getCertificate(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+	cs.RLock()
+	defer cs.RUnlock()
+
+	for _, cert := range cs.certs {
+		if hello.SupportsCertificate(cert) == nil {
+			return cert, nil
+		}
+	}
+	return cs.certs[0], nil
+}
+
+// files returns the certificate and key files, so that they can be watched
+func (cs *certStore) files() []string {
+	files := make([]string, 0, 2*len(cs.specs))
+	for _, spec := range cs.specs {
+		files = append(files, spec.CertFile, spec.KeyFile)
+	}
+	return files
+}
+
+// it builds the TLS config of the HTTPS listener
+func newTLSConfig(spec config.TLS, store *certStore) (*tls.Config, error) {
+	minVersion, found := tlsVersions[spec.MinVersion]
+	if !found {
+		return nil, fmt.Errorf(
+			"unsupported TLS min version `%s`, should be of (1.0/1.1/1.2/1.3)", spec.MinVersion)
+	}
+
+	var cipherSuites []uint16
+	for _, name := range spec.CipherSuites {
+		id, err := cipherSuiteID(name)
+		if err != nil {
+			return nil, err
+		}
+		cipherSuites = append(cipherSuites, id)
+	}
+
+	tlsConfig := &tls.Config{
+		MinVersion:     minVersion,
+		CipherSuites:   cipherSuites,
+		GetCertificate: store.getCertificate,
+		NextProtos:     []string{"h2", "http/1.1"},
+	}
+
+	switch spec.ClientAuth {
+	case "", "none":
+		return tlsConfig, nil
+	case "request":
+		tlsConfig.ClientAuth = tls.VerifyClientCertIfGiven
+	case "require":
+		tlsConfig.ClientAuth = tls.RequireAndVerifyClientCert
+	default:
+		return nil, fmt.Errorf(
+			"unsupported client auth `%s`, should be of (none/request/require)", spec.ClientAuth)
+	}
+
+	if spec.ClientCAFile == "" {
+		return nil, errors.New("client CA file is required to verify client certificates")
+	}
+	pem, err := ioutil.ReadFile(spec.ClientCAFile)
+	if err != nil {
+		return nil, fmt.Errorf("could not read client CA file [%s]", err)
+	}
+	tlsConfig.ClientCAs = x509.NewCertPool()
+	if !tlsConfig.ClientCAs.AppendCertsFromPEM(pem) {
+		return nil, fmt.Errorf("no certificate found in client CA file %s", spec.ClientCAFile)
+	}
+
+	return tlsConfig, nil
+}
+
+// it reports if client certificates are verified by the HTTPS listener
+func clientAuthEnabled(spec config.TLS) bool {
+	return spec.Enabled && spec.ClientAuth != "" && spec.ClientAuth != "none"
+}
+
+func cipherSuiteID(name string) (uint16, error) {
+	for _, suite := range tls.CipherSuites() {
+		if suite.Name == name {
+			return suite.ID, nil
+		}
+	}
+	for _, suite := range tls.InsecureCipherSuites() {
+		if suite.Name == name {
+			logger.Warn("insecure cipher suite is configured", "cipher_suite", name)
+			return suite.ID, nil
+		}
+	}
+	return 0, fmt.Errorf("unsupported cipher suite `%s`", name)
+}
+
+// it creates the https server instance, listens and serves https requests
+func (s *Server) startHTTPSServer(r http.Handler, tlsConfig *tls.Config) error {
+	addr := fmt.Sprintf(":%v", s.globalConfig.TLS.Port)
+
+	s.tlsServer = &http.Server{
+		Addr:         addr,
+		Handler:      r,
+		TLSConfig:    tlsConfig,
+		ReadTimeout:  time.Duration(s.globalConfig.ReadTimeout) * time.Second,
+		WriteTimeout: time.Duration(s.globalConfig.WriteTimeout) * time.Second,
+		IdleTimeout:  time.Duration(s.globalConfig.IdleTimeout) * time.Second,
+		ErrorLog:     logger.StdLogger(logger.ErrorLevel),
+	}
+
+	logger.Info("server will listen for TLS", "addr", addr)
+
+	l, err := s.realIP.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	// certificates are served by the TLS config
+	return s.tlsServer.ServeTLS(l, "", "")
+}
+
+// ReloadCertificates reloads the TLS certificates from disk
+func (s *Server) ReloadCertificates() error {
+	if s.certStore == nil {
+		return nil
+	}
+	if err := s.certStore.reload(); err != nil {
+		return err
+	}
+
+	logger.Info("TLS certificates reloaded")
+	return nil
+}
+
+// it watches the certificate and key files to reload them once they change
+func (s *Server) watchCertificates() {
+	reload := func() {
+		if err := s.ReloadCertificates(); err != nil {
+			logger.Error("reload failed, keeping current certificates", "error", err)
+		}
+	}
+
+	interval := time.Duration(s.globalConfig.WatchInterval) * time.Second
+	for _, file := range s.certStore.files() {
+		w := watcher.New(file, interval, reload)
+		w.Start()
+		s.watchers = append(s.watchers, w)
+	}
+}
+
+// redirectToHTTPS redirects requests to the HTTPS listener
+func (s *Server) redirectToHTTPS() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host := r.Host
+		if h, _, err := net.SplitHostPort(r.Host); err == nil {
+			host = h
+		}
+		if port := s.globalConfig.TLS.Port; port != 443 {
+			host = net.JoinHostPort(host, strconv.Itoa(port))
+		}
+
+		status := http.StatusPermanentRedirect
+		if r.Method == http.MethodGet || r.Method == http.MethodHead {
+			status = http.StatusMovedPermanently
+		}
+		http.Redirect(w, r, "https://"+host+r.URL.RequestURI(), status)
+	})
+}
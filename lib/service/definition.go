@@ -2,24 +2,29 @@ package service
 
 import (
 	"encoding/json"
-	"log"
+	"errors"
+	"fmt"
 
+	"github.com/AyushSenapati/guardian/lib/accesslog"
+	"github.com/AyushSenapati/guardian/lib/logger"
+	"github.com/AyushSenapati/guardian/lib/plugin"
 	"github.com/AyushSenapati/guardian/lib/proxy"
 )
 
 // Plugin defines the plugin data structure that each service definition can have
 type Plugin struct {
-	Name   string
-	Enable bool
-	Config map[string]interface{}
+	Name   string                 `json:"name"`
+	Enable bool                   `json:"enable"`
+	Config map[string]interface{} `json:"config"`
 }
 
 // Definition defines service config, which needs to be proxied
 type Definition struct {
-	Name    string
-	Active  bool
-	Proxy   *proxy.Definition
-	Plugins []Plugin
+	Name      string            `json:"name"`
+	Active    bool              `json:"active"`
+	Proxy     *proxy.Definition `json:"proxy"`
+	Plugins   []Plugin          `json:"plugins"`
+	AccessLog *accesslog.Config `json:"access_log,omitempty"`
 }
 
 // NewDefinition returns new instance of service definition initialised with defaults
@@ -31,6 +36,58 @@ func NewDefinition() *Definition {
 	}
 }
 
+// Validate checks if the service definition is complete and refers to known plugins
+func (d *Definition) Validate() error {
+	if d.Name == "" {
+		return errors.New("service name can not be blank")
+	}
+
+	if d.Proxy == nil {
+		return fmt.Errorf("service `%s`: proxy definition is missing", d.Name)
+	}
+	if err := d.Proxy.Validate(); err != nil {
+		return fmt.Errorf("service `%s`: %s", d.Name, err)
+	}
+
+	names := make([]string, 0, len(d.Plugins))
+	for _, plg := range d.Plugins {
+		if _, err := plugin.GetSetupFunc(plg.Name); err != nil {
+			return fmt.Errorf("service `%s`: %s", d.Name, err)
+		}
+		names = append(names, plg.Name)
+	}
+	if err := plugin.ValidateOrder(names); err != nil {
+		return fmt.Errorf("service `%s`: %s", d.Name, err)
+	}
+
+	return nil
+}
+
+// Clone returns a copy of the definition which can be modified
+// without affecting the services registered using the original one
+func (d *Definition) Clone() *Definition {
+	clone := *d
+	clone.Plugins = make([]Plugin, len(d.Plugins))
+	copy(clone.Plugins, d.Plugins)
+	return &clone
+}
+
+// ValidateDefinitions validates each of the definitions
+// and makes sure that service names are unique
+func ValidateDefinitions(definitions []*Definition) error {
+	names := make(map[string]bool)
+	for _, def := range definitions {
+		if err := def.Validate(); err != nil {
+			return err
+		}
+		if names[def.Name] {
+			return fmt.Errorf("service `%s` is defined more than once", def.Name)
+		}
+		names[def.Name] = true
+	}
+	return nil
+}
+
 // Configuration holds the service configurations
 type Configuration struct {
 	Definitions []*Definition
@@ -41,11 +98,20 @@ func (c *Configuration) UnmarshalJSON(b []byte) error {
 	return json.Unmarshal(b, &c.Definitions)
 }
 
-// ParseAndLoad parses and loads raw config
-func ParseAndLoad(rawConfig []byte) []*Definition {
+// Parse parses raw config and returns the service definitions
+func Parse(rawConfig []byte) ([]*Definition, error) {
 	config := Configuration{}
 	if err := json.Unmarshal(rawConfig, &config); err != nil {
-		log.Println(err)
+		return nil, err
+	}
+	return config.Definitions, nil
+}
+
+// ParseAndLoad parses and loads raw config
+func ParseAndLoad(rawConfig []byte) []*Definition {
+	definitions, err := Parse(rawConfig)
+	if err != nil {
+		logger.Error("could not parse service definitions", "error", err)
 	}
-	return config.Definitions
+	return definitions
 }
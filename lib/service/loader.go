@@ -1,9 +1,13 @@
 package service
 
 import (
+	"errors"
+	"fmt"
 	"io/ioutil"
-	"log"
+	"strings"
 
+	"github.com/AyushSenapati/guardian/lib/accesslog"
+	"github.com/AyushSenapati/guardian/lib/logger"
 	"github.com/AyushSenapati/guardian/lib/plugin"
 	"github.com/AyushSenapati/guardian/lib/proxy"
 )
@@ -22,60 +26,111 @@ func NewLoader(r *proxy.Register) *Loader {
 func (l *Loader) LoadServiceDefinitions(filePath string) []*Definition {
 	config, err := ioutil.ReadFile(filePath)
 	if err != nil {
-		log.Println("srv: error reading service definition file", filePath)
+		logger.Error("error reading service definition file", "file", filePath, "error", err)
 		return []*Definition{}
 	}
 
 	// Parse and load the service definitions
 	definitions := ParseAndLoad(config)
 	for _, def := range definitions {
-		log.Printf("debug: PROXY CONFIGURATION: %+v", def.Proxy)
-		log.Printf("debug: PLUGIN CONFIGURATION: %+v", def.Plugins)
+		logger.Debug(
+			"service definition loaded",
+			"service", def.Name, "proxy", def.Proxy, "plugins", def.Plugins,
+		)
 	}
 
 	return definitions
 }
 
-// RegisterServices registers the provided service defitions
-func (l *Loader) RegisterServices(definitions []*Definition) {
+// ReadServiceDefinitions reads provided config file and returns service definitions.
+// Unlike LoadServiceDefinitions it reports read and parse errors to the caller,
+// so that a broken definition file does not wipe out the registered services
+func (l *Loader) ReadServiceDefinitions(filePath string) ([]*Definition, error) {
+	config, err := ioutil.ReadFile(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("error reading service definition file %s: %w", filePath, err)
+	}
+
+	definitions, err := Parse(config)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing service definition file %s: %w", filePath, err)
+	}
+
+	return definitions, nil
+}
+
+// RegisterServices registers the provided service defitions. Services which
+// could not be registered are reported in the returned error
+func (l *Loader) RegisterServices(definitions []*Definition) error {
+	var failed []string
 	for _, def := range definitions {
-		l.registerService(def)
+		if err := l.registerService(def); err != nil {
+			logger.Error("service registration failed", "service", def.Name, "error", err)
+			failed = append(failed, err.Error())
+		}
+	}
+
+	if len(failed) > 0 {
+		return errors.New(strings.Join(failed, "; "))
 	}
+	return nil
 }
 
-func (l *Loader) registerService(svcDef *Definition) {
-	log.Printf("debug: register service: %s... started\n", svcDef.Name)
+func (l *Loader) registerService(svcDef *Definition) error {
+	log := logger.With("service", svcDef.Name)
+	log.Debug("registering service")
 
 	if !svcDef.Active {
-		log.Printf("warn: service %s is not active. skipping registraion\n", svcDef.Name)
-		return
+		log.Warn("service is not active, skipping registration")
+		return nil
 	}
 
 	routerDefinition := proxy.NewRouterDefinition(svcDef.Proxy)
+	routerDefinition.Name = svcDef.Name
 
-	// Configure the service specific plugins
+	// service specific access log must be the first middleware,
+	// so that it logs the requests rejected by the plugins too
+	if svcDef.AccessLog != nil {
+		accessLog, err := accesslog.New(*svcDef.AccessLog)
+		if err != nil {
+			return fmt.Errorf("service `%s`: %s", svcDef.Name, err)
+		}
+		routerDefinition.AddMiddleware(accessLog)
+		routerDefinition.NameMiddlewares("access-log")
+	}
+
+	// Configure the service specific plugins. Service is not registered
+	// if any of its plugins fails, so that it never runs without them
 	for _, plg := range svcDef.Plugins {
-		log.Printf("debug: registering plugin: %s for service: %s...", plg.Name, svcDef.Name)
+		log.Debug("registering plugin", "plugin", plg.Name)
 		if !plg.Enable {
-			log.Printf(" warn: plugin `%s` is not enabled!!! skipping...", plg.Name)
+			log.Warn("plugin is not enabled, skipping", "plugin", plg.Name)
 			continue
 		}
 
 		// Get the setup function from the plugin registry by its name
 		setupFunc, err := plugin.GetSetupFunc(plg.Name)
 		if err != nil {
-			log.Printf("error: could not load plugin `%s`", plg.Name)
-			continue
+			log.Error("could not load plugin", "plugin", plg.Name)
+			l.Register.Discard(routerDefinition)
+			return fmt.Errorf("service `%s`: %s", svcDef.Name, err)
 		}
 
 		err = setupFunc(routerDefinition, plg.Config)
 		if err != nil {
-			log.Printf("error: failed configuring plugin:`%s` [%s]", plg.Name, err)
+			log.Error("failed configuring plugin", "plugin", plg.Name, "error", err)
+			l.Register.Discard(routerDefinition)
+			return fmt.Errorf(
+				"service `%s`: failed configuring plugin `%s` [%s]", svcDef.Name, plg.Name, err)
 		}
+		routerDefinition.NameMiddlewares(plg.Name)
 	}
 
 	// Register the proxy configs along with plugins in the proxy register
-	l.Register.Add(routerDefinition)
+	if err := l.Register.Add(routerDefinition); err != nil {
+		return fmt.Errorf("service `%s`: %s", svcDef.Name, err)
+	}
 
-	log.Printf("debug: register service: %s... Completed\n", svcDef.Name)
+	log.Debug("service registered")
+	return nil
 }
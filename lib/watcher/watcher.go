@@ -0,0 +1,76 @@
+package watcher
+
+import (
+	"os"
+	"sync"
+	"time"
+
+	"github.com/AyushSenapati/guardian/lib/logger"
+)
+
+// Watcher polls a file at the given interval and invokes
+// the callback whenever modification time or size of the file changes
+type Watcher struct {
+	path     string
+	interval time.Duration
+	onChange func()
+
+	modTime  time.Time
+	size     int64
+	stopChan chan struct{}
+	stopOnce sync.Once
+}
+
+// New returns a watcher for the given file. Call Start to begin watching
+func New(path string, interval time.Duration, onChange func()) *Watcher {
+	w := &Watcher{
+		path:     path,
+		interval: interval,
+		onChange: onChange,
+		stopChan: make(chan struct{}),
+	}
+	w.changed() // record the current state of the file
+	return w
+}
+
+// Start launches a go routine which keeps polling the file till Stop is called
+func (w *Watcher) Start() {
+	ticker := time.NewTicker(w.interval)
+
+	go func() {
+		defer ticker.Stop()
+		for {
+			select {
+			case <-w.stopChan:
+				return
+			case <-ticker.C:
+				if w.changed() {
+					logger.Debug("watched file has changed", "file", w.path)
+					w.onChange()
+				}
+			}
+		}
+	}()
+}
+
+// Stop stops watching the file. It is safe to call Stop multiple times
+func (w *Watcher) Stop() {
+	w.stopOnce.Do(func() { close(w.stopChan) })
+}
+
+// changed reports if the file has changed since it was last checked.
+// A missing file is not reported as a change, so that a file being
+// replaced by an editor does not trigger a reload with no content
+func (w *Watcher) changed() bool {
+	info, err := os.Stat(w.path)
+	if err != nil {
+		return false
+	}
+
+	if info.ModTime().Equal(w.modTime) && info.Size() == w.size {
+		return false
+	}
+
+	w.modTime, w.size = info.ModTime(), info.Size()
+	return true
+}
@@ -1,17 +1,14 @@
 package main
 
 import (
-	"log"
-	"os"
-
 	"github.com/AyushSenapati/guardian/cmd"
+	"github.com/AyushSenapati/guardian/lib/logger"
 )
 
 func main() {
 	rootCmd := cmd.RootCmd()
 
 	if err := rootCmd.Execute(); err != nil {
-		log.Fatal(err)
-		os.Exit(1)
+		logger.Fatal("could not execute command", "error", err)
 	}
 }